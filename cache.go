@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/kyoh86/git-prompt/prompt"
+	"github.com/wacul/ulog"
+)
+
+// cacheKey identifies a state of the repository and options to collect it.
+// It will be changed when the index file is updated.
+type cacheKey struct {
+	Root      string
+	IndexTime int64
+	IndexSize int64
+	Options   string
+}
+
+type cacheEntry struct {
+	Key      cacheKey
+	StoredAt time.Time
+	Stat     prompt.Stat
+}
+
+func newCacheKey(root string, opt prompt.Options) (cacheKey, error) {
+	gitDir, err := git.FindGitDir(root)
+	if err != nil {
+		return cacheKey{}, err
+	}
+	info, err := os.Stat(filepath.Join(gitDir, "index"))
+	if err != nil {
+		return cacheKey{}, err
+	}
+	return cacheKey{
+		Root:      root,
+		IndexTime: info.ModTime().UnixNano(),
+		IndexSize: info.Size(),
+		Options:   optionsKey(opt),
+	}, nil
+}
+
+// optionsKey hashes the options which change collected statuses (e.g. --compare-ref),
+// not to serve statuses collected with other flags (e.g. a tmux line and a zsh prompt).
+// The Fields and the Jobs are ignored: the cache has all the fields.
+func optionsKey(opt prompt.Options) string {
+	opt.Fields = nil
+	opt.Jobs = 0
+	var wip string
+	if opt.Wip != nil {
+		wip = opt.Wip.String()
+	}
+	// the options have no value which fails to be serialized
+	raw, _ := json.Marshal(struct {
+		Options prompt.Options
+		Wip     string
+	}{opt, wip})
+	sum := sha1.Sum(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func cacheFile(cacheDir string, key cacheKey) string {
+	sum := sha1.Sum([]byte(key.Root + "\x00" + key.Options))
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:])+".json")
+}
+
+// loadCache will get statuses cached for the repository containing the dir without calling git.
+func loadCache(ctx context.Context, cacheDir, dir string, opt prompt.Options, ttl time.Duration) (prompt.Stat, bool) {
+	logger := ulog.Logger(ctx)
+	root, err := git.FindRoot(dir)
+	if err != nil {
+		logger.WithField("error", err).Debug("failed to find a root of the repository")
+		return prompt.Stat{}, false
+	}
+	key, err := newCacheKey(root, opt)
+	if err != nil {
+		logger.WithField("error", err).Debug("failed to get a cache key")
+		return prompt.Stat{}, false
+	}
+	raw, err := ioutil.ReadFile(cacheFile(cacheDir, key))
+	if err != nil {
+		logger.WithField("error", err).Debug("failed to read a cache")
+		return prompt.Stat{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		logger.WithField("error", err).Debug("failed to parse a cache")
+		return prompt.Stat{}, false
+	}
+	if entry.Key != key || time.Since(entry.StoredAt) > ttl {
+		return prompt.Stat{}, false
+	}
+	return entry.Stat, true
+}
+
+// storeCache will save statuses to the cache.
+func storeCache(ctx context.Context, cacheDir string, opt prompt.Options, stat prompt.Stat) {
+	logger := ulog.Logger(ctx)
+	key, err := newCacheKey(stat.Root, opt)
+	if err != nil {
+		logger.WithField("error", err).Debug("failed to get a cache key")
+		return
+	}
+	raw, err := json.Marshal(cacheEntry{Key: key, StoredAt: time.Now(), Stat: stat})
+	if err != nil {
+		logger.WithField("error", err).Warn("failed to serialize a cache")
+		return
+	}
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		logger.WithField("error", err).Warn("failed to create a cache directory")
+		return
+	}
+	if err := ioutil.WriteFile(cacheFile(cacheDir, key), raw, 0600); err != nil {
+		logger.WithField("error", err).Warn("failed to write a cache")
+	}
+}
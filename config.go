@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// config is loaded from the config file to set defaults of options.
+type config struct {
+	Style          string                 `toml:"style"`
+	Theme          string                 `toml:"theme"`
+	BaseBranch     string                 `toml:"base_branch"`
+	WipPattern     string                 `toml:"wip_pattern"`
+	Timeout        string                 `toml:"timeout"`
+	Skip           []string               `toml:"skip"`
+	StatusExcludes []string               `toml:"status_excludes"`
+	Symbols        map[string]string      `toml:"symbols"`
+	Colors         map[string]string      `toml:"colors"`
+	Styles         map[string]styleConfig `toml:"styles"`
+	Forges         map[string]string      `toml:"forges"`
+}
+
+// styleConfig is a named style defined in the config file.
+type styleConfig struct {
+	Template string `toml:"template"`
+	// Colorizer is a name of the built-in style (e.g. "zsh" or "tmux") to color
+	// with in the "color" function. The style is not colored if it is empty.
+	Colorizer string `toml:"colorizer"`
+}
+
+// registerStyles adds the styles in the config to the built-in ones, overwriting the same names.
+func registerStyles(defs map[string]styleConfig) error {
+	for name, def := range defs {
+		if def.Colorizer != "" {
+			colorize, ok := colorizers[def.Colorizer]
+			if !ok {
+				return errors.Errorf("unknown colorizer %q for the style %q", def.Colorizer, name)
+			}
+			colorizers[name] = colorize
+			if escape, ok := styleEscapes[def.Colorizer]; ok {
+				styleEscapes[name] = escape
+			}
+		}
+		styles[name] = def.Template
+	}
+	return nil
+}
+
+// configFile finds a path of the config file in $XDG_CONFIG_HOME or ~/.config.
+func configFile() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "git-prompt", "config.toml")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "git-prompt", "config.toml")
+}
+
+// loadConfig loads the config file. If it does not exist, it returns an empty config.
+func loadConfig() (cfg config, _ error) {
+	path := configFile()
+	if path == "" {
+		return cfg, nil
+	}
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, errors.Wrapf(err, "invalid config file %s", path)
+	}
+	return cfg, nil
+}
+
+// orDefault returns the value or the default if the value is empty.
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
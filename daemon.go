@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/kyoh86/git-prompt/prompt"
+	"github.com/wacul/ulog"
+)
+
+// daemonRequest asks the daemon for statuses of the repository containing the Dir,
+// collected with the Options (and the pattern of the Wip in them) of the query.
+// Requests and responses are sent as a line of JSON.
+type daemonRequest struct {
+	Dir     string         `json:"dir"`
+	Options prompt.Options `json:"options"`
+	Wip     string         `json:"wip,omitempty"`
+}
+
+type daemonResponse struct {
+	Stat  prompt.Stat `json:"stat"`
+	Error string      `json:"error,omitempty"`
+}
+
+// defaultSocket is a path of the unix socket for the daemon in the runtime directory of the user,
+// or in a directory of the user in the temporary directory (made by the daemon only for the user).
+func defaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "git-prompt.sock")
+	}
+	return filepath.Join(os.TempDir(), "git-prompt-"+strconv.Itoa(os.Getuid()), "daemon.sock")
+}
+
+// daemon keeps statuses of repositories in memory with the same key as the cache,
+// so they are collected again when the index is updated, the ttl is passed or
+// a query has other options.
+type daemon struct {
+	option  *options
+	mutex   sync.Mutex
+	entries map[string]cacheEntry
+	locks   map[string]*rootLock
+}
+
+// rootLock is a lock for a root of a repository, removed when no request uses it.
+type rootLock struct {
+	sync.Mutex
+	users int // requests holding or waiting for the lock
+}
+
+// serveDaemon answers requests on the unix socket until SIGINT or SIGTERM.
+func serveDaemon(ctx context.Context, socket string, option *options) error {
+	logger := ulog.Logger(ctx)
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return errors.New("another daemon is listening on " + socket)
+	}
+	// the socket is left by a daemon which has not exited cleanly
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// statuses of the repositories are only for the user
+	listener, err := listenPrivate(socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	closed := make(chan struct{})
+	go func() {
+		<-signals
+		close(closed)
+		listener.Close()
+	}()
+
+	d := &daemon{option: option, entries: map[string]cacheEntry{}, locks: map[string]*rootLock{}}
+	logger.WithField("socket", socket).Info("listening")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-closed:
+				return nil
+			default:
+				return err
+			}
+		}
+		go d.serve(ctx, conn)
+	}
+}
+
+func (d *daemon) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	logger := ulog.Logger(ctx)
+	var req daemonRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		logger.WithField("error", err).Debug("failed to read a request")
+		return
+	}
+	var res daemonResponse
+	stat, err := d.load(ctx, req)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Stat = stat
+	}
+	if err := json.NewEncoder(conn).Encode(res); err != nil {
+		logger.WithField("error", err).Debug("failed to write a response")
+	}
+}
+
+// lock locks the root of a repository, and returns the function to unlock it.
+func (d *daemon) lock(root string) func() {
+	d.mutex.Lock()
+	lock, ok := d.locks[root]
+	if !ok {
+		lock = &rootLock{}
+		d.locks[root] = lock
+	}
+	lock.users++
+	d.mutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(d.locks, root)
+		}
+	}
+}
+
+// prune removes the entries expired by the ttl, not to keep repositories which are not used any more.
+// It should be called with the mutex locked.
+func (d *daemon) prune() {
+	for id, entry := range d.entries {
+		if time.Since(entry.StoredAt) > d.option.CacheTTL {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// load gets statuses of the repository from the memory, or collects them.
+// Requests for a repository are answered one by one not to run git for it at once,
+// and ones for other repositories are not blocked by it.
+func (d *daemon) load(ctx context.Context, req daemonRequest) (prompt.Stat, error) {
+	opt := req.Options
+	if req.Wip != "" {
+		wip, err := regexp.Compile(req.Wip)
+		if err != nil {
+			return prompt.Stat{}, err
+		}
+		opt.Wip = wip
+	}
+	// all the fields are kept for any style of queries
+	opt.Fields = nil
+	opt.Jobs = d.option.Collect.Jobs
+
+	root, err := git.FindRoot(req.Dir)
+	if err != nil {
+		return prompt.Stat{}, err
+	}
+	key, err := newCacheKey(root, opt)
+	if err != nil {
+		return prompt.Stat{}, err
+	}
+	defer d.lock(root)()
+	id := key.Root + "\x00" + key.Options
+	d.mutex.Lock()
+	entry, ok := d.entries[id]
+	d.mutex.Unlock()
+	if ok && entry.Key == key && time.Since(entry.StoredAt) <= d.option.CacheTTL {
+		return entry.Stat, nil
+	}
+
+	collectCtx := ctx
+	if d.option.Timeout > 0 {
+		var cancel context.CancelFunc
+		collectCtx, cancel = context.WithTimeout(ctx, d.option.Timeout)
+		defer cancel()
+	}
+	repo, err := git.OpenDirContext(collectCtx, req.Dir)
+	if err != nil {
+		return prompt.Stat{}, err
+	}
+	defer repo.Close()
+	stat := *prompt.CollectRepo(collectCtx, repo, opt)
+	if !stat.Degraded && stat.Errors == nil {
+		d.mutex.Lock()
+		d.prune()
+		d.entries[id] = cacheEntry{Key: key, StoredAt: time.Now(), Stat: stat}
+		d.mutex.Unlock()
+	}
+	return stat, nil
+}
+
+// queryDaemon gets statuses of the repository containing the dir from the daemon.
+// It returns false if the daemon is not running or cannot answer, to collect them locally.
+func queryDaemon(ctx context.Context, socket, dir string, opt prompt.Options) (prompt.Stat, bool) {
+	logger := ulog.Logger(ctx)
+	if err := checkSocketOwner(socket); err != nil {
+		logger.WithField("error", err).Debug("the daemon is not running for the user")
+		return prompt.Stat{}, false
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		logger.WithField("error", err).Debug("failed to connect to the daemon")
+		return prompt.Stat{}, false
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	req := daemonRequest{Dir: dir, Options: opt}
+	if opt.Wip != nil {
+		req.Wip = opt.Wip.String()
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		logger.WithField("error", err).Debug("failed to send a request to the daemon")
+		return prompt.Stat{}, false
+	}
+	var res daemonResponse
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		logger.WithField("error", err).Debug("failed to read a response from the daemon")
+		return prompt.Stat{}, false
+	}
+	if res.Error != "" {
+		logger.WithField("error", res.Error).Debug("the daemon failed to collect statuses")
+		return prompt.Stat{}, false
+	}
+	return res.Stat, true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDaemon(ttl time.Duration) *daemon {
+	return &daemon{option: &options{CacheTTL: ttl}, entries: map[string]cacheEntry{}, locks: map[string]*rootLock{}}
+}
+
+// TestDaemonLock checks locks of roots are removed after the requests for them.
+func TestDaemonLock(t *testing.T) {
+	d := newTestDaemon(time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer d.lock("/repo")()
+			time.Sleep(time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	if len(d.locks) != 0 {
+		t.Errorf("expect no lock left but got %d", len(d.locks))
+	}
+}
+
+// TestDaemonPrune checks expired entries are removed.
+func TestDaemonPrune(t *testing.T) {
+	d := newTestDaemon(time.Second)
+	d.entries["old"] = cacheEntry{StoredAt: time.Now().Add(-time.Minute)}
+	d.entries["new"] = cacheEntry{StoredAt: time.Now()}
+	d.prune()
+	if _, ok := d.entries["old"]; ok {
+		t.Error("expect the expired entry to be removed")
+	}
+	if _, ok := d.entries["new"]; !ok {
+		t.Error("expect the fresh entry to be kept")
+	}
+}
@@ -0,0 +1,35 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenPrivate listens on the unix socket which only the user can connect to.
+// It is created with the umask 0077, so it is never open to others even for a moment.
+func listenPrivate(socket string) (net.Listener, error) {
+	mask := syscall.Umask(0077)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", socket)
+}
+
+// checkSocketOwner checks the socket is made by the same user, not to trust statuses sent by
+// another user who has bound the path first (e.g. in a shared /tmp).
+func checkSocketOwner(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("failed to get the owner of %s", path)
+	}
+	if int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by another user (uid %d)", path, stat.Uid)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// +build windows
+
+package main
+
+import "net"
+
+// listenPrivate listens on the unix socket in the temporary directory of the user.
+func listenPrivate(socket string) (net.Listener, error) {
+	return net.Listen("unix", socket)
+}
+
+// checkSocketOwner does nothing on Windows, where the socket is in the temporary directory of the user.
+func checkSocketOwner(path string) error {
+	return nil
+}
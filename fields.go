@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"github.com/kyoh86/git-prompt/prompt"
+	"github.com/pkg/errors"
+)
+
+// usedFields lists keys of fields which the templates refer to (e.g. "branch" for "{{.Branch}}").
+// It returns nil (all fields) if any of them passes the dot itself (e.g. "{{template "x" .}}"),
+// because the fields which are used then cannot be known.
+func usedFields(trees ...*parse.Tree) map[string]bool {
+	set := map[string]bool{}
+	all := false
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		if all || node == nil {
+			return
+		}
+		switch node := node.(type) {
+		case *parse.DotNode:
+			all = true
+		case *parse.FieldNode:
+			set[prompt.FieldKey(node.Ident[0])] = true
+		case *parse.VariableNode:
+			// e.g. "$.Branch"
+			if len(node.Ident) > 1 && node.Ident[0] == "$" {
+				set[prompt.FieldKey(node.Ident[1])] = true
+			}
+		case *parse.ChainNode:
+			walk(node.Node)
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, child := range node.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(node.Pipe)
+		case *parse.PipeNode:
+			if node == nil {
+				return
+			}
+			for _, cmd := range node.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range node.Args {
+				walk(arg)
+			}
+		case *parse.IfNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walk(node.Pipe)
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.TemplateNode:
+			walk(node.Pipe)
+		}
+	}
+	for _, tree := range trees {
+		if tree != nil {
+			walk(tree.Root)
+		}
+	}
+	if all {
+		return nil
+	}
+	return set
+}
+
+// formatFields formats values of the named fields in the stat, each followed by the terminator.
+// Names are case-insensitive and may be in snake_case (e.g. "branch" or "last_email").
+func formatFields(stat prompt.Stat, names []string, terminator string) (string, error) {
+	value := reflect.ValueOf(stat)
+	var builder strings.Builder
+	for _, name := range names {
+		field := value.FieldByNameFunc(func(fieldName string) bool {
+			return strings.EqualFold(fieldName, strings.ReplaceAll(name, "_", ""))
+		})
+		if !field.IsValid() {
+			return "", errors.Errorf("unknown field %q", name)
+		}
+		switch v := field.Interface().(type) {
+		case []string:
+			builder.WriteString(strings.Join(v, ","))
+		case map[string]string:
+			pairs := make([]string, 0, len(v))
+			for key, value := range v {
+				pairs = append(pairs, key+"="+value)
+			}
+			sort.Strings(pairs)
+			builder.WriteString(strings.Join(pairs, ","))
+		default:
+			fmt.Fprint(&builder, v)
+		}
+		builder.WriteString(terminator)
+	}
+	return builder.String(), nil
+}
+
+// dumpFields dumps all the fields of the stat with their names in Go to debug,
+// ignoring the omitempty of the json tags.
+func dumpFields(stat prompt.Stat) ([]byte, error) {
+	value := reflect.ValueOf(stat)
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i := 0; i < value.NumField(); i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		name, err := json.Marshal(value.Type().Field(i).Name)
+		if err != nil {
+			return nil, err
+		}
+		field, err := json.Marshal(value.Field(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteString(":")
+		buf.Write(field)
+	}
+	buf.WriteString("}")
+
+	var dump bytes.Buffer
+	if err := json.Indent(&dump, buf.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	dump.WriteString("\n")
+	return dump.Bytes(), nil
+}
+
+// escapeFields escapes all the strings in the stat (including ones in slices and maps)
+// with the escape, to be interpolated into the template.
+func escapeFields(stat prompt.Stat, escape func(string) string) prompt.Stat {
+	value := reflect.ValueOf(&stat).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		switch v := field.Interface().(type) {
+		case string:
+			field.SetString(escape(v))
+		case []string:
+			if v == nil {
+				continue
+			}
+			escaped := make([]string, len(v))
+			for j, item := range v {
+				escaped[j] = escape(item)
+			}
+			field.Set(reflect.ValueOf(escaped))
+		case map[string]string:
+			if v == nil {
+				continue
+			}
+			escaped := make(map[string]string, len(v))
+			for key, item := range v {
+				escaped[escape(key)] = escape(item)
+			}
+			field.Set(reflect.ValueOf(escaped))
+		}
+	}
+	return stat
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// colorizers wraps a body with the escape sequences for the named color in each style.
+var colorizers = map[string]func(name, body string) string{
+	"zsh":   zshColorize,
+	"short": zshColorize,
+	"zsh-zero-width": func(name, body string) string {
+		return "%{%F{" + name + "}%}" + body + "%{%f%}"
+	},
+	"tmux": func(name, body string) string {
+		return "#[fg=" + name + "]" + body + "#[fg=default]"
+	},
+	"ansi":       ansiColorize,
+	"pwsh":       ansiColorize,
+	"powershell": ansiColorize,
+	"bash":       bashColorize,
+}
+
+func zshColorize(name, body string) string {
+	return "%F{" + name + "}" + body + "%f"
+}
+
+func ansiColorize(name, body string) string {
+	code, ok := ansiColors[name]
+	if !ok {
+		return body
+	}
+	return "\x1b[" + code + "m" + body + "\x1b[39m"
+}
+
+// bashColorize wraps SGR sequences in "\[" and "\]" for PS1, so bash does not count them in the width.
+// They are decoded when PS1 is set with the output (e.g. in PROMPT_COMMAND), not in "$(...)" of PS1.
+func bashColorize(name, body string) string {
+	code, ok := ansiColors[name]
+	if !ok {
+		return body
+	}
+	return `\[\e[` + code + `m\]` + body + `\[\e[39m\]`
+}
+
+// ansiColors maps color names to SGR foreground codes.
+var ansiColors = map[string]string{
+	"black":   "30",
+	"red":     "31",
+	"green":   "32",
+	"yellow":  "33",
+	"blue":    "34",
+	"magenta": "35",
+	"cyan":    "36",
+	"white":   "37",
+	"default": "39",
+}
+
+// themes map roles of parts in styles to color names for the --theme.
+// An empty color leaves the part uncolored.
+var themes = map[string]map[string]string{
+	"dark": {
+		"dirty":       "yellow",
+		"conflicted":  "red",
+		"wip":         "red",
+		"ahead":       "red",
+		"behind":      "magenta",
+		"base":        "yellow",
+		"base_ahead":  "green",
+		"base_behind": "red",
+		"stash":       "yellow",
+		"name":        "blue",
+		"subdir":      "yellow",
+		"branch":      "green",
+		"no_upstream": "red",
+		"action":      "red",
+		"error":       "red",
+	},
+	"light": {
+		"dirty":       "magenta",
+		"conflicted":  "red",
+		"wip":         "red",
+		"ahead":       "red",
+		"behind":      "blue",
+		"base":        "default",
+		"base_ahead":  "green",
+		"base_behind": "red",
+		"stash":       "magenta",
+		"name":        "blue",
+		"subdir":      "default",
+		"branch":      "green",
+		"no_upstream": "red",
+		"action":      "red",
+		"error":       "red",
+	},
+	"mono": {
+		"dirty":       "",
+		"conflicted":  "",
+		"wip":         "",
+		"ahead":       "",
+		"behind":      "",
+		"base":        "",
+		"base_ahead":  "",
+		"base_behind": "",
+		"stash":       "",
+		"name":        "",
+		"subdir":      "",
+		"branch":      "",
+		"no_upstream": "",
+		"action":      "",
+		"error":       "",
+	},
+}
+
+// themeNames lists the names which can be given to the --theme.
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mergeColors overwrites colors of the roles in the theme with the colors (e.g. from the config file).
+func mergeColors(theme map[string]string, colors map[string]string) map[string]string {
+	merged := make(map[string]string, len(theme)+len(colors))
+	for role, color := range theme {
+		merged[role] = color
+	}
+	for role, color := range colors {
+		merged[role] = color
+	}
+	return merged
+}
+
+// defaultSymbols are used in styles by the "symbol" function, and can be overwritten in the config.
+var defaultSymbols = map[string]string{
+	"conflicted":  "✖",
+	"staged":      "+",
+	"unstaged":    "-",
+	"untracked":   "?",
+	"wip":         "!wip!",
+	"ahead":       "⬆",
+	"behind":      "⬇",
+	"stash":       "♻",
+	"no_upstream": "⚑",
+	"degraded":    "…",
+	"error":       "✗",
+}
+
+// resolveColorizer gets the name of the colorizer for the style: the given one (e.g. by the --colorizer),
+// or the style itself. Styles without a colorizer (e.g. "format:...") are not colored.
+func resolveColorizer(style, colorizer string) (string, error) {
+	if colorizer == "" {
+		return style, nil
+	}
+	if _, ok := colorizers[colorizer]; !ok {
+		return "", errors.Errorf("unknown colorizer %q (available: %s)", colorizer, strings.Join(colorizerNames(), ", "))
+	}
+	return colorizer, nil
+}
+
+// colorizerNames lists the names which can be given to the --colorizer.
+func colorizerNames() []string {
+	names := make([]string, 0, len(colorizers))
+	for name := range colorizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// templateFuncs builds functions which can be called in the template with the colorizer (see resolveColorizer).
+// The "color" function takes a role in the theme or a color name.
+// The "config" function gets a value of the git config with the config.
+// With escapeHTML, the "color" function escapes the body for HTML unless it is from the "symbol"
+// or another "color", because html/template does not escape the values which they return.
+func templateFuncs(colorizer string, theme map[string]string, symbols map[string]string, config func(key string) (string, error), escapeHTML bool) template.FuncMap {
+	return template.FuncMap{
+		"config": config,
+		"symbol": func(name string) htmltemplate.HTML {
+			if symbol, ok := symbols[name]; ok {
+				return htmltemplate.HTML(symbol)
+			}
+			return htmltemplate.HTML(defaultSymbols[name])
+		},
+		"truncate": truncate,
+		"lower":    strings.ToLower,
+		"upper":    strings.ToUpper,
+		"color": func(name string, body interface{}) htmltemplate.HTML {
+			text := fmt.Sprint(body)
+			if _, trusted := body.(htmltemplate.HTML); escapeHTML && !trusted {
+				text = htmltemplate.HTMLEscapeString(text)
+			}
+			if color, ok := theme[name]; ok {
+				name = color
+			}
+			colorize, ok := colorizers[colorizer]
+			if !ok || name == "" {
+				return htmltemplate.HTML(text)
+			}
+			return htmltemplate.HTML(colorize(name, text))
+		},
+	}
+}
+
+// escapes are modes of escaping values in templates for the --escape.
+// "auto" escapes by the style (see styleEscapes).
+var escapes = []string{"auto", "none", "html", "bash"}
+
+// escapeBash escapes the value to be shown literally in PS1 of bash: PS1 is decoded
+// ("\\" to "\") and then expanded ("$(...)", "`...`" and "${...}") each time it is shown,
+// so a branch or a tag name like "$(touch x)" would run a command in the shell.
+func escapeBash(value string) string {
+	var builder strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			builder.WriteString(`\\\\`)
+		case '$', '`':
+			builder.WriteString(`\\`)
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// styleTemplate is a parsed template for the style.
+type styleTemplate struct {
+	execute func(w io.Writer, data interface{}) error
+	trees   []*parse.Tree
+}
+
+// parseStyle parses the format with text/template, or html/template for the escape "html"
+// (e.g. for status bars which render HTML).
+func parseStyle(format string, escape string, funcs template.FuncMap) (*styleTemplate, error) {
+	if escape == "html" {
+		tmp, err := htmltemplate.New("stat").Funcs(htmltemplate.FuncMap(funcs)).Parse(format)
+		if err != nil {
+			return nil, err
+		}
+		style := &styleTemplate{execute: tmp.Execute}
+		for _, t := range tmp.Templates() {
+			style.trees = append(style.trees, t.Tree)
+		}
+		return style, nil
+	}
+	tmp, err := template.New("stat").Funcs(funcs).Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	style := &styleTemplate{execute: tmp.Execute}
+	for _, t := range tmp.Templates() {
+		style.trees = append(style.trees, t.Tree)
+	}
+	return style, nil
+}
+
+// truncate shortens s to n runes, replacing the tail with an ellipsis.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/prompt"
+)
+
+// TestColorizeFormat runs a custom format with the colorizer given by the --colorizer.
+func TestColorizeFormat(t *testing.T) {
+	const format = `{{color "branch" .Branch}} {{color "red" "!"}}`
+	for _, c := range []struct {
+		name      string
+		colorizer string
+		expect    string
+	}{
+		{name: "none", colorizer: "", expect: "feat !"},
+		{name: "ansi", colorizer: "ansi", expect: "\x1b[32mfeat\x1b[39m \x1b[31m!\x1b[39m"},
+		{name: "zsh", colorizer: "zsh", expect: "%F{green}feat%f %F{red}!%f"},
+		{name: "tmux", colorizer: "tmux", expect: "#[fg=green]feat#[fg=default] #[fg=red]!#[fg=default]"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			colorizer, err := resolveColorizer("format:"+format, c.colorizer)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			config := func(string) (string, error) { return "", nil }
+			tmp, err := parseStyle(format, "none", templateFuncs(colorizer, themes["dark"], nil, config, false))
+			if err != nil {
+				t.Fatalf("failed to parse the format: %s", err)
+			}
+			var buf bytes.Buffer
+			if err := tmp.execute(&buf, prompt.Stat{Branch: "feat"}); err != nil {
+				t.Fatalf("failed to execute the format: %s", err)
+			}
+			if actual := buf.String(); actual != c.expect {
+				t.Errorf("expect %q but got %q", c.expect, actual)
+			}
+		})
+	}
+}
+
+func TestResolveColorizerUnknown(t *testing.T) {
+	if _, err := resolveColorizer("format:{{.Branch}}", "fish"); err == nil {
+		t.Error("expect an error for an unknown colorizer")
+	}
+}
@@ -0,0 +1,112 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Action detects an operation in progress like "rebase-i", "merge" or "cherry-pick"
+// from the files in the git directory, as the git-prompt.sh of git does.
+// Step and total are set for the rebase and "git am", which stop on each of commits or patches.
+// It returns empty if no operation is in progress.
+func (g *Git) Action() (action string, step, total int, _ error) {
+	gitDir := g.gitDir
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(gitDir, name))
+		return err == nil
+	}
+	read := func(name string) int {
+		content, err := ioutil.ReadFile(filepath.Join(gitDir, name))
+		if err != nil {
+			return 0
+		}
+		n, _ := parseInt32(strings.TrimSpace(string(content)))
+		return n
+	}
+
+	switch {
+	case exists("rebase-merge"):
+		action = "rebase-m"
+		if exists(filepath.Join("rebase-merge", "interactive")) {
+			action = "rebase-i"
+		}
+		return action, read(filepath.Join("rebase-merge", "msgnum")), read(filepath.Join("rebase-merge", "end")), nil
+	case exists("rebase-apply"):
+		// "git am" and the rebase with the apply backend share the directory, and mark it
+		// with "applying" or "rebasing". Without them, it is in the middle of starting.
+		switch {
+		case exists(filepath.Join("rebase-apply", "rebasing")):
+			action = "rebase"
+		case exists(filepath.Join("rebase-apply", "applying")):
+			action = "am"
+		default:
+			action = "am/rebase"
+		}
+		return action, read(filepath.Join("rebase-apply", "next")), read(filepath.Join("rebase-apply", "last")), nil
+	case exists("MERGE_HEAD"):
+		return "merge", 0, 0, nil
+	case exists("CHERRY_PICK_HEAD"):
+		return "cherry-pick", 0, 0, nil
+	case exists("REVERT_HEAD"):
+		return "revert", 0, 0, nil
+	case exists("BISECT_LOG"):
+		return "bisect", 0, 0, nil
+	}
+	return "", 0, 0, nil
+}
+
+// operations are names of the actions in the upper case, as the git-prompt.sh of git shows.
+var operations = map[string]string{
+	"rebase-i":    "REBASE-i",
+	"rebase-m":    "REBASE-m",
+	"rebase":      "REBASE",
+	"am":          "AM",
+	"am/rebase":   "AM/REBASE",
+	"merge":       "MERGING",
+	"cherry-pick": "CHERRY-PICKING",
+	"revert":      "REVERTING",
+	"bisect":      "BISECTING",
+}
+
+// OperationVar :
+func (g *Git) OperationVar(v *string) error {
+	return stringSetter(g.Operation())(v)
+}
+
+// Operation gets the Action named like "MERGING", "REBASE-i" or "CHERRY-PICKING".
+// It returns empty if no operation is in progress.
+func (g *Git) Operation() (string, error) {
+	action, _, _, err := g.Action()
+	if err != nil {
+		return "", err
+	}
+	return operations[action], nil
+}
+
+// ConflictedVar :
+func (g *Git) ConflictedVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.Conflicted(ctx))(v)
+}
+
+// Conflicted checks the index has unmerged paths (e.g. "UU", "AA" or "DD" in the status).
+func (g *Git) Conflicted(ctx context.Context) (bool, error) {
+	count, err := g.ConflictCount(ctx)
+	return count > 0, err
+}
+
+// ConflictCountVar :
+func (g *Git) ConflictCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.ConflictCount(ctx))(v)
+}
+
+// ConflictCount counts unmerged paths.
+func (g *Git) ConflictCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return p.Conflicted, nil
+}
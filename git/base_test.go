@@ -0,0 +1,43 @@
+package git_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git/testutil"
+)
+
+// TestBaseBranch checks the order of BaseBranch: the default branch of the remote,
+// a remote branch guessed from the name, then origin/main or origin/master.
+func TestBaseBranch(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		refs   []string
+		head   string
+		expect string
+		guess  string
+	}{
+		{name: "remote HEAD over guess", refs: []string{"main", "feature"}, head: "main", expect: "origin/main", guess: "origin/feature"},
+		{name: "guess without remote HEAD", refs: []string{"main", "feature"}, expect: "origin/feature", guess: "origin/feature"},
+		{name: "master", refs: []string{"master"}, expect: "origin/master"},
+		{name: "nothing", expect: "origin/main"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			r := testutil.NewRepo(t)
+			defer r.Remove()
+			r.Commit("first")
+			r.Checkout("feature/foo", true)
+			r.Git("remote", "add", "origin", "https://example.com/origin/repo.git")
+			for _, ref := range c.refs {
+				r.Git("update-ref", "refs/remotes/origin/"+ref, "HEAD")
+			}
+			if c.head != "" {
+				r.Git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/"+c.head)
+			}
+			g := r.Open()
+			assertString(t, "BaseBranch", c.expect)(g.BaseBranch(context.Background(), "feature/foo"))
+			assertString(t, "GuessBaseBranch", c.guess)(g.GuessBaseBranch(context.Background(), "feature/foo"))
+		})
+	}
+}
@@ -2,112 +2,155 @@ package git
 
 import (
 	"bytes"
-	"io"
-	"io/ioutil"
+	"context"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 // Git handles git command and get informations from repository.
 type Git struct {
-	dir     string
-	tmpFile *os.File
-	envs    []string
+	dir    string
+	gitDir string
+	envs   []string
 
-	cache sync.Map
+	path    string
+	timeout time.Duration
+	runner  Runner
+
+	cache      sync.Map
+	callsMutex sync.Mutex
+	calls      map[string]*call
+
+	versionOnce sync.Once
+	version     version
+	versionText string
+	versionErr  error
+
+	statusFilter  StatusFilter
+	porcelainOnce sync.Once
+	porcelain     *porcelain
+	porcelainErr  error
 }
 
 var (
 	// ErrIsNotInWorkingDirectory :
 	ErrIsNotInWorkingDirectory = errors.New("not in working directory")
-)
 
-// OpenDir current directory
-func OpenDir(dir string) (git *Git, reterr error) {
-	git = &Git{}
+	// ErrNoLFS : git-lfs is not installed
+	ErrNoLFS = errors.New("git-lfs is not installed")
 
-	{
-		output, _ := runGit(func(cmd *exec.Cmd) {
-			cmd.Dir = dir
-		}, `rev-parse`, `--is-inside-work-tree`)
-		if !bytes.Equal([]byte(`true`), bytes.TrimSpace(output)) {
-			return nil, ErrIsNotInWorkingDirectory
-		}
-	}
+	// ErrNoCommits : the current branch has no commit yet
+	ErrNoCommits = errors.New("no commits yet")
 
-	{
-		output, err := runGit(func(cmd *exec.Cmd) {
-			cmd.Dir = dir
-		}, `rev-parse`, `--show-toplevel`)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to open current directory")
-		}
-		git.dir = string(bytes.TrimSpace(output))
-	}
+	// Path of the git executable to run.
+	Path = "git"
+)
 
-	{
-		src, err := os.Open(filepath.Join(git.dir, ".git", "index"))
-		if os.IsNotExist(err) {
-			return nil, ErrIsNotInWorkingDirectory
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to open an index file")
-		}
-		defer func() {
-			if err := src.Close(); err != nil && reterr == nil {
-				reterr = err
-			}
-		}()
-
-		{
-			tmpFile, err := ioutil.TempFile("", "git-prompt")
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to create a tempfile")
-			}
-			git.tmpFile = tmpFile
-		}
-		buffer := make([]byte, 1024*1024)
-		if _, err := io.CopyBuffer(git.tmpFile, src, buffer); err != nil {
-			return nil, errors.Wrap(err, "failed to copy an index file")
+// OpenDir opens the repository containing the dir.
+// It is the same as OpenDirContext with context.Background.
+func OpenDir(dir string, opts ...Option) (*Git, error) {
+	return OpenDirContext(context.Background(), dir, opts...)
+}
+
+// OpenDirContext opens the repository containing the dir, running git with the ctx to discover it.
+// Methods of the Git take their own ctx: when it is done (e.g. timed out), the running command is
+// killed and others fail at once.
+//
+// Git reads the index of the repository directly, and "git status" is called with
+// --no-optional-locks not to refresh (write) it. It used to copy the index into a
+// tempfile instead, which cost 5-10ms per prompt for an index of 7MB (100k files).
+func OpenDirContext(ctx context.Context, dir string, opts ...Option) (*Git, error) {
+	g := &Git{
+		envs: os.Environ(),
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
 		}
 	}
-	git.envs = append(os.Environ(), "GIT_INDEX_FILE="+git.tmpFile.Name())
-	return git, nil
+	// discover the work tree and the git directory at once:
+	// it fails in the git directory or outside of repositories.
+	output, err := g.run(ctx, dir, "rev-parse", "--is-inside-work-tree", "--show-toplevel", "--absolute-git-dir")
+	if isExitError(err) {
+		return nil, ErrIsNotInWorkingDirectory
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open current directory")
+	}
+	discovered, _ := lines(output, nil)
+	if len(discovered) != 3 || discovered[1] == "" {
+		return nil, ErrIsNotInWorkingDirectory
+	}
+	// the dir may be out of the work tree given by GIT_WORK_TREE (or core.worktree) with GIT_DIR
+	if !bytes.Equal([]byte(discovered[0]), trueBytes) && g.getenv("GIT_DIR") == "" {
+		return nil, ErrIsNotInWorkingDirectory
+	}
+	g.dir = discovered[1]
+	g.gitDir = discovered[2]
+	return g, nil
 }
 
 // Close git repository
 func (g *Git) Close() error {
-	if g.tmpFile == nil {
-		return nil
-	}
-	if err := g.tmpFile.Close(); err != nil {
-		return err
-	}
-	return os.Remove(g.tmpFile.Name())
+	return nil
 }
 
-// Call git with arguments. If true given in lock, escape the index file.
+// Call git with arguments. The output is cached for the same arguments.
+// It is the same as CallContext with context.Background.
 func (g *Git) Call(args ...string) ([]byte, error) {
+	return g.CallContext(context.Background(), args...)
+}
+
+// call is a running git command whose result is shared by callers with the same arguments.
+type call struct {
+	done   chan struct{}
+	output []byte
+	err    error
+}
+
+// CallContext calls git with arguments like Call, but with the ctx.
+// All the methods of Git call git through it with their ctx.
+//
+// Callers with the same arguments at once (e.g. methods collected in parallel) wait for
+// the first one and share its result, instead of running git for each of them.
+func (g *Git) CallContext(ctx context.Context, args ...string) ([]byte, error) {
 	key := strings.Join(args, " ")
 	if cache, ok := g.cache.Load(key); ok {
 		return cache.([]byte), nil
 	}
-	output, err := runGit(func(cmd *exec.Cmd) {
-		cmd.Env = g.envs
-		cmd.Dir = g.dir
-	}, args...)
-	if err != nil {
-		return nil, err
+
+	g.callsMutex.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.callsMutex.Unlock()
+		select {
+		case <-c.done:
+			return c.output, c.err
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "failed to wait for git (%q)", key)
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	if g.calls == nil {
+		g.calls = map[string]*call{}
 	}
-	g.cache.Store(key, output)
-	return output, nil
+	g.calls[key] = c
+	g.callsMutex.Unlock()
+
+	c.output, c.err = g.run(ctx, g.dir, args...)
+	if c.err == nil {
+		g.cache.Store(key, c.output)
+	}
+	g.callsMutex.Lock()
+	delete(g.calls, key)
+	g.callsMutex.Unlock()
+	close(c.done)
+	return c.output, c.err
 }
 
 // Root directory
@@ -116,99 +159,265 @@ func (g *Git) Root() string {
 }
 
 // BranchVar :
-func (g *Git) BranchVar(v *string) error {
-	return stringSetter(g.Branch())(v)
+func (g *Git) BranchVar(ctx context.Context, v *string) error {
+	return stringSetter(g.Branch(ctx))(v)
 }
 
-const (
-	branchPrefix     = "## "
-	branchInitPrefix = branchPrefix + "No commits yet on "
-)
-
-var (
-	branchRegexp = regexp.MustCompile(`^## (\S+)\.\.\.(\S+/\S+)(?: \[(?:ahead (\d+))?(?:, )?(?:behind (\d+))?\])?$`)
-)
-
 // Branch :
-func (g *Git) Branch() (string, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) Branch(ctx context.Context) (string, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return "", err
 	}
-	var line string
-	if !scanFunc(output)(&line) {
-		return "", nil
-	}
-	if !strings.HasPrefix(line, branchPrefix) {
-		return "", nil
+	return p.Branch, nil
+}
+
+// BranchFastVar :
+func (g *Git) BranchFastVar(ctx context.Context, v *string) error {
+	return stringSetter(g.BranchFast(ctx))(v)
+}
+
+// BranchFast gets the current branch without "git status": by "git branch --show-current" (2.22+),
+// or "git symbolic-ref" for older gits. It returns Head if the HEAD is detached.
+func (g *Git) BranchFast(ctx context.Context) (string, error) {
+	var branch string
+	var err error
+	if g.versionAtLeast(ctx, 2, 22) {
+		// it prints nothing for a detached HEAD
+		branch, err = str(g.CallContext(ctx, "branch", "--show-current"))
+	} else {
+		// it exits with 1 for a detached HEAD
+		branch, err = strOrEmpty(g.CallContext(ctx, "symbolic-ref", "--quiet", "--short", Head))
 	}
-	if strings.HasPrefix(line, branchInitPrefix) {
-		return strings.TrimPrefix(line, branchInitPrefix), nil
+	if err != nil || branch != "" {
+		return branch, err
 	}
-	if matches := branchRegexp.FindStringSubmatch(line); len(matches) > 1 {
-		return matches[1], nil
+	return Head, nil
+}
+
+// HasCommitsVar :
+func (g *Git) HasCommitsVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.HasCommits(ctx))(v)
+}
+
+// HasCommits checks the current branch has any commit.
+func (g *Git) HasCommits(ctx context.Context) (bool, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return false, err
 	}
-	return strings.TrimPrefix(line, branchPrefix), nil
+	return !p.NoCommits, nil
+}
+
+// CommitCountVar :
+func (g *Git) CommitCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.CommitCount(ctx))(v)
+}
+
+// CommitCount counts commits in the history of the current branch.
+// It returns 0 if there's no commit yet.
+func (g *Git) CommitCount(ctx context.Context) (int, error) {
+	return numberOrZero(g.CallContext(ctx, "rev-list", "--count", Head))
 }
 
 // UpstreamVar :
-func (g *Git) UpstreamVar(v *string) error {
-	return stringSetter(g.Upstream())(v)
+func (g *Git) UpstreamVar(ctx context.Context, v *string) error {
+	return stringSetter(g.Upstream(ctx))(v)
 }
 
 // Upstream :
-func (g *Git) Upstream() (string, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) Upstream(ctx context.Context) (string, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return "", err
 	}
-	var line string
-	if !scanFunc(output)(&line) {
-		return "", nil
+	return p.Upstream, nil
+}
+
+// UpstreamRemoteVar :
+func (g *Git) UpstreamRemoteVar(ctx context.Context, v *string) error {
+	return stringSetter(g.UpstreamRemote(ctx))(v)
+}
+
+// UpstreamRemote gets the remote name of the upstream.
+func (g *Git) UpstreamRemote(ctx context.Context) (string, error) {
+	remote, _, err := g.splitUpstream(ctx)
+	return remote, err
+}
+
+// UpstreamBranchVar :
+func (g *Git) UpstreamBranchVar(ctx context.Context, v *string) error {
+	return stringSetter(g.UpstreamBranch(ctx))(v)
+}
+
+// UpstreamBranch gets the branch name of the upstream without the remote name.
+func (g *Git) UpstreamBranch(ctx context.Context) (string, error) {
+	_, branch, err := g.splitUpstream(ctx)
+	return branch, err
+}
+
+func (g *Git) splitUpstream(ctx context.Context) (string, string, error) {
+	upstream, err := g.Upstream(ctx)
+	if err != nil || upstream == "" {
+		return "", "", err
 	}
-	if matches := branchRegexp.FindStringSubmatch(line); len(matches) > 2 {
-		return matches[2], nil
+	remotes, err := g.RemoteNames(ctx)
+	if err != nil {
+		return "", "", err
 	}
-	return "", nil
+	remote, branch := splitRemoteRef(remotes, upstream)
+	return remote, branch, nil
+}
+
+// UpstreamGoneVar :
+func (g *Git) UpstreamGoneVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.UpstreamGone(ctx))(v)
+}
+
+// UpstreamGone checks the upstream branch is configured but gone from the remote.
+func (g *Git) UpstreamGone(ctx context.Context) (bool, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return false, err
+	}
+	return p.UpstreamGone, nil
+}
+
+// PushRemoteVar :
+func (g *Git) PushRemoteVar(ctx context.Context, v *string) error {
+	return stringSetter(g.PushRemote(ctx))(v)
+}
+
+// PushRemote gets the branch where the current branch will be pushed to.
+// It returns empty if no push target is configured.
+func (g *Git) PushRemote(ctx context.Context) (string, error) {
+	return strOrEmpty(g.CallContext(ctx, "rev-parse", "--abbrev-ref", "@{push}"))
 }
 
 // RemoteVar :
-func (g *Git) RemoteVar(branch string, v *string) error {
-	return stringSetter(g.Remote(branch))(v)
+func (g *Git) RemoteVar(ctx context.Context, branch string, v *string) error {
+	return stringSetter(g.Remote(ctx, branch))(v)
+}
+
+// Remote gets the remote for the branch.
+// If the branch has no remote, it falls back to remote.pushDefault, the single remote or "origin".
+func (g *Git) Remote(ctx context.Context, branch string) (string, error) {
+	if remote, err := strOrEmpty(g.CallContext(ctx, "config", "--local", "--get", "branch."+branch+".remote")); err != nil || remote != "" {
+		return remote, err
+	}
+	if remote, err := strOrEmpty(g.CallContext(ctx, "config", "--get", "remote.pushDefault")); err != nil || remote != "" {
+		return remote, err
+	}
+	remotes, err := g.RemoteNames(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, remote := range remotes {
+		if remote == "origin" {
+			return remote, nil
+		}
+	}
+	if len(remotes) == 1 {
+		return remotes[0], nil
+	}
+	return "", nil
 }
 
-// Remote :
-func (g *Git) Remote(branch string) (string, error) {
-	return strOrEmpty(g.Call("config", "--local", "--get", "branch."+branch+".remote"))
+// RemoteNames lists names of the remotes.
+func (g *Git) RemoteNames(ctx context.Context) ([]string, error) {
+	output, err := g.CallContext(ctx, "remote")
+	if err != nil {
+		return nil, err
+	}
+	var remotes []string
+	var line string
+	for lines := scanFunc(output); lines(&line); {
+		remotes = append(remotes, line)
+	}
+	return remotes, nil
+}
+
+// splitRemoteRef splits a remote-tracking ref like "origin/main" into the remote and the branch.
+// Remote names may contain "/", so the longest matching remote name is used.
+func splitRemoteRef(remotes []string, ref string) (remote, branch string) {
+	for _, name := range remotes {
+		if len(name) > len(remote) && strings.HasPrefix(ref, name+"/") {
+			remote = name
+		}
+	}
+	if remote == "" {
+		return "", ""
+	}
+	return remote, strings.TrimPrefix(ref, remote+"/")
 }
 
 // RemoteURLVar :
-func (g *Git) RemoteURLVar(remote string, v *string) error {
-	return stringSetter(g.RemoteURL(remote))(v)
+func (g *Git) RemoteURLVar(ctx context.Context, remote string, v *string) error {
+	return stringSetter(g.RemoteURL(ctx, remote))(v)
 }
 
 // RemoteURL :
-func (g *Git) RemoteURL(remote string) (string, error) {
-	return strOrEmpty(g.Call("remote", "get-url", remote))
+func (g *Git) RemoteURL(ctx context.Context, remote string) (string, error) {
+	return strOrEmpty(g.CallContext(ctx, "remote", "get-url", remote))
+}
+
+// RemotesVar :
+func (g *Git) RemotesVar(ctx context.Context, v *map[string]string) error {
+	return stringMapSetter(g.Remotes(ctx))(v)
+}
+
+// Remotes maps names of the remotes to their (fetch) URLs.
+func (g *Git) Remotes(ctx context.Context) (map[string]string, error) {
+	output, err := g.CallContext(ctx, "remote", "-v")
+	if err != nil {
+		return nil, err
+	}
+	remotes := map[string]string{}
+	var line string
+	for lines := scanFunc(output); lines(&line); {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[2] != "(fetch)" {
+			continue
+		}
+		remotes[fields[0]] = fields[1]
+	}
+	return remotes, nil
 }
 
 // StashCountVar :
-func (g *Git) StashCountVar(v *int) error {
-	return intSetter(g.StashCount())(v)
+func (g *Git) StashCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.StashCount(ctx))(v)
+}
+
+// StashCount counts entries in the reflog of the stash without listing them.
+// It returns 0 if there's no stash.
+func (g *Git) StashCount(ctx context.Context) (int, error) {
+	return numberOrZero(g.CallContext(ctx, "rev-list", "--walk-reflogs", "--count", "refs/stash"))
 }
 
-// StashCount :
-func (g *Git) StashCount() (int, error) {
-	return count(g.Call("stash", "list"))
+// LatestStash gets the message (e.g. "WIP on main: 1a2b3c fix") and the relative age
+// (e.g. "2 days ago") of the latest stash. They are empty if there's no stash.
+func (g *Git) LatestStash(ctx context.Context) (message, age string, err error) {
+	output, err := str(g.CallContext(ctx, "stash", "list", "-n", "1", "--format=%gs%x00%cr"))
+	if err != nil || output == "" {
+		return "", "", err
+	}
+	fields := strings.SplitN(output, "\x00", 2)
+	if len(fields) < 2 {
+		return fields[0], "", nil
+	}
+	return fields[0], fields[1], nil
 }
 
-func (g *Git) diffCount(baseBranch, headBranch string) (int, error) {
-	return countOrZero(g.Call("rev-list", baseBranch+".."+headBranch))
+// diffCount counts commits in headBranch which are not in baseBranch.
+// It returns 0 if either of them does not exist.
+func (g *Git) diffCount(ctx context.Context, baseBranch, headBranch string) (int, error) {
+	return numberOrZero(g.CallContext(ctx, "rev-list", "--count", baseBranch+".."+headBranch))
 }
 
 // AheadCountVar :
-func (g *Git) AheadCountVar(v *int) error {
-	return intSetter(g.AheadCount())(v)
+func (g *Git) AheadCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.AheadCount(ctx))(v)
 }
 
 func parseInt32(str string) (int, error) {
@@ -220,163 +429,458 @@ func parseInt32(str string) (int, error) {
 }
 
 // AheadCount :
-func (g *Git) AheadCount() (int, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) AheadCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return 0, err
 	}
-	var line string
-	if !scanFunc(output)(&line) {
-		return 0, nil
-	}
-	if matches := branchRegexp.FindStringSubmatch(line); len(matches) > 3 {
-		return parseInt32(matches[3])
-	}
-	return 0, nil
+	return p.Ahead, nil
 }
 
 // BehindCountVar :
-func (g *Git) BehindCountVar(v *int) error {
-	return intSetter(g.BehindCount())(v)
+func (g *Git) BehindCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.BehindCount(ctx))(v)
 }
 
 // Head :
 const Head = "HEAD"
 
 // BehindCount :
-func (g *Git) BehindCount() (int, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) BehindCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return 0, err
 	}
-	var line string
-	if !scanFunc(output)(&line) {
-		return 0, nil
-	}
-	if matches := branchRegexp.FindStringSubmatch(line); len(matches) > 4 {
-		return parseInt32(matches[4])
-	}
-	return 0, nil
+	return p.Behind, nil
 }
 
 // BehindCountFromVar :
-func (g *Git) BehindCountFromVar(baseBranch string, v *int) error {
-	return intSetter(g.BehindCountFrom(baseBranch))(v)
+func (g *Git) BehindCountFromVar(ctx context.Context, baseBranch string, v *int) error {
+	return intSetter(g.BehindCountFrom(ctx, baseBranch))(v)
 }
 
 // BehindCountFrom :
-func (g *Git) BehindCountFrom(baseBranch string) (int, error) {
-	return g.diffCount(Head, baseBranch)
+func (g *Git) BehindCountFrom(ctx context.Context, baseBranch string) (int, error) {
+	return g.diffCount(ctx, Head, baseBranch)
+}
+
+// AheadCountFromVar :
+func (g *Git) AheadCountFromVar(ctx context.Context, baseBranch string, v *int) error {
+	return intSetter(g.AheadCountFrom(ctx, baseBranch))(v)
+}
+
+// AheadCountFrom :
+func (g *Git) AheadCountFrom(ctx context.Context, baseBranch string) (int, error) {
+	return g.diffCount(ctx, baseBranch, Head)
+}
+
+// RefExists checks the ref points at a commit.
+func (g *Git) RefExists(ctx context.Context, ref string) (bool, error) {
+	hash, err := strOrEmpty(g.CallContext(ctx, "rev-parse", "--verify", "--quiet", ref+"^{commit}"))
+	return hash != "", err
+}
+
+// MergeBase gets the best common ancestor of the HEAD and the branch.
+// It returns empty if they have no common ancestor.
+func (g *Git) MergeBase(ctx context.Context, branch string) (string, error) {
+	return strOrEmpty(g.CallContext(ctx, "merge-base", Head, branch))
+}
+
+// CountFromMergeBase counts commits on the HEAD (ahead) and on the branch (behind)
+// since the merge-base of them. It differs from AheadCountFrom and BehindCountFrom,
+// which compare the tips, only when they have multiple merge-bases (criss-cross merges):
+// then commits since the single merge-base chosen by "git merge-base" are counted.
+func (g *Git) CountFromMergeBase(ctx context.Context, branch string) (ahead, behind int, _ error) {
+	mergeBase, err := g.MergeBase(ctx, branch)
+	if err != nil || mergeBase == "" {
+		return 0, 0, err
+	}
+	if ahead, err = g.diffCount(ctx, mergeBase, Head); err != nil {
+		return 0, 0, err
+	}
+	if behind, err = g.diffCount(ctx, mergeBase, branch); err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
 }
 
 // EmailVar :
-func (g *Git) EmailVar(v *string) error {
-	return stringSetter(g.Email())(v)
+func (g *Git) EmailVar(ctx context.Context, v *string) error {
+	return stringSetter(g.Email(ctx))(v)
 }
 
-// Email :
-func (g *Git) Email() (string, error) {
-	return str(g.Call("config", "user.email"))
+// Email gets user.email from the config.
+// It returns empty if it is not set.
+func (g *Git) Email(ctx context.Context) (string, error) {
+	return strOrEmpty(g.CallContext(ctx, "config", "--get", "user.email"))
+}
+
+// LocalEmailVar :
+func (g *Git) LocalEmailVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LocalEmail(ctx))(v)
+}
+
+// LocalEmail gets user.email only from the repository local config.
+func (g *Git) LocalEmail(ctx context.Context) (string, error) {
+	return strOrEmpty(g.CallContext(ctx, "config", "--local", "--get", "user.email"))
+}
+
+// lastCommit gets a property of the last commit with "git log -n1".
+// It returns ErrNoCommits if the current branch has no commit yet.
+func (g *Git) lastCommit(ctx context.Context, args ...string) (string, error) {
+	if hasCommits, err := g.HasCommits(ctx); err != nil {
+		return "", err
+	} else if !hasCommits {
+		return "", ErrNoCommits
+	}
+	return str(g.CallContext(ctx, append([]string{"log", "-n1"}, args...)...))
 }
 
 // LastCommitterVar :
-func (g *Git) LastCommitterVar(v *string) error {
-	return stringSetter(g.LastCommitter())(v)
+func (g *Git) LastCommitterVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LastCommitter(ctx))(v)
 }
 
 // LastCommitter :
-func (g *Git) LastCommitter() (string, error) {
-	return str(g.Call("log", "-n1", "--pretty=%ce"))
+func (g *Git) LastCommitter(ctx context.Context) (string, error) {
+	return g.lastCommit(ctx, "--pretty=%ce")
+}
+
+// LastAuthorEmailVar :
+func (g *Git) LastAuthorEmailVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LastAuthorEmail(ctx))(v)
+}
+
+// LastAuthorEmail gets the author email of the last commit, which may differ from the committer.
+func (g *Git) LastAuthorEmail(ctx context.Context) (string, error) {
+	return g.lastCommit(ctx, "--pretty=%ae")
+}
+
+// LastAuthorVar :
+func (g *Git) LastAuthorVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LastAuthor(ctx))(v)
+}
+
+// LastAuthor :
+func (g *Git) LastAuthor(ctx context.Context) (string, error) {
+	return g.lastCommit(ctx, "--pretty=%an")
+}
+
+// LastCommitRelativeVar :
+func (g *Git) LastCommitRelativeVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LastCommitRelative(ctx))(v)
+}
+
+// LastCommitRelative :
+func (g *Git) LastCommitRelative(ctx context.Context) (string, error) {
+	return g.lastCommit(ctx, "--pretty=%cr")
 }
 
 // LastCommitMessageVar :
-func (g *Git) LastCommitMessageVar(v *string) error {
-	return stringSetter(g.LastCommitMessage())(v)
+func (g *Git) LastCommitMessageVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LastCommitMessage(ctx))(v)
 }
 
 // LastCommitMessage :
-func (g *Git) LastCommitMessage() (string, error) {
-	return str(g.Call("log", "-n1", "--pretty=%s"))
+func (g *Git) LastCommitMessage(ctx context.Context) (string, error) {
+	return g.lastCommit(ctx, "--pretty=%s")
 }
 
 // LastCommitHashVar :
-func (g *Git) LastCommitHashVar(v *string) error {
-	return stringSetter(g.LastCommitHash())(v)
+func (g *Git) LastCommitHashVar(ctx context.Context, v *string) error {
+	return stringSetter(g.LastCommitHash(ctx))(v)
 }
 
 // LastCommitHash :
-func (g *Git) LastCommitHash() (string, error) {
-	return str(g.Call("log", "-n1", "--pretty=%h"))
+func (g *Git) LastCommitHash(ctx context.Context) (string, error) {
+	return g.lastCommit(ctx, "--pretty=%h")
+}
+
+// AbbrevCommitHashVar :
+func (g *Git) AbbrevCommitHashVar(ctx context.Context, length int, v *string) error {
+	return stringSetter(g.AbbrevCommitHash(ctx, length))(v)
+}
+
+// AbbrevCommitHash gets the last commit hash abbreviated to at least the length.
+func (g *Git) AbbrevCommitHash(ctx context.Context, length int) (string, error) {
+	return g.lastCommit(ctx, "--abbrev="+strconv.Itoa(length), "--pretty=%h")
+}
+
+// DescribeVar :
+func (g *Git) DescribeVar(ctx context.Context, length int, v *string) error {
+	return stringSetter(g.Describe(ctx, length))(v)
+}
+
+// Describe names HEAD from the nearest tag like "v1.2.3-4-gabcdef" with "git describe --tags --always".
+// It is the commit hash abbreviated to at least the length if no tag is reachable.
+func (g *Git) Describe(ctx context.Context, length int) (string, error) {
+	return str(g.CallContext(ctx, "describe", "--tags", "--always", "--abbrev="+strconv.Itoa(length)))
+}
+
+// TagsVar :
+func (g *Git) TagsVar(ctx context.Context, v *[]string) error {
+	return stringsSetter(g.Tags(ctx))(v)
+}
+
+// Tags gets tags which point at HEAD.
+func (g *Git) Tags(ctx context.Context) ([]string, error) {
+	if hasCommits, err := g.HasCommits(ctx); err != nil || !hasCommits {
+		return []string{}, err
+	}
+	return lines(g.CallContext(ctx, "tag", "--points-at", Head))
+}
+
+// StagedCountVar :
+func (g *Git) StagedCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.StagedCount(ctx))(v)
+}
+
+// StagedCount counts files which have changes staged in the index.
+func (g *Git) StagedCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return p.Staged, nil
 }
 
 // StagedVar :
-func (g *Git) StagedVar(v *bool) error {
-	return boolSetter(g.Staged())(v)
+func (g *Git) StagedVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.Staged(ctx))(v)
 }
 
 // Staged :
-func (g *Git) Staged() (bool, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) Staged(ctx context.Context) (bool, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return false, err
 	}
-	var line string
-	for lines := scanFunc(output); lines(&line); {
-		if len(line) >= 1 && (line[0] == 'M' || line[0] == 'D' || line[0] == 'R' || line[0] == 'A') {
-			return true, nil
-		}
+	return p.Staged > 0, nil
+}
+
+// UnstagedCountVar :
+func (g *Git) UnstagedCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.UnstagedCount(ctx))(v)
+}
+
+// UnstagedCount counts files which have changes not staged in the work tree.
+func (g *Git) UnstagedCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return 0, err
 	}
-	return false, nil
+	return p.Unstaged, nil
 }
 
 // UnstagedVar :
-func (g *Git) UnstagedVar(v *bool) error {
-	return boolSetter(g.Unstaged())(v)
+func (g *Git) UnstagedVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.Unstaged(ctx))(v)
 }
 
 // Unstaged :
-func (g *Git) Unstaged() (bool, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) Unstaged(ctx context.Context) (bool, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return false, err
 	}
-	var line string
-	for lines := scanFunc(output); lines(&line); {
-		if len(line) >= 2 && (line[1] == 'M' || line[1] == 'D') {
-			return true, nil
-		}
+	return p.Unstaged > 0, nil
+}
+
+// UntrackedCountVar :
+func (g *Git) UntrackedCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.UntrackedCount(ctx))(v)
+}
+
+// UntrackedCount counts untracked files (an untracked directory counts as one).
+func (g *Git) UntrackedCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return 0, err
 	}
-	return false, nil
+	return p.Untracked, nil
 }
 
 // UntrackedVar :
-func (g *Git) UntrackedVar(v *bool) error {
-	return boolSetter(g.Untracked())(v)
+func (g *Git) UntrackedVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.Untracked(ctx))(v)
 }
 
 // Untracked :
-func (g *Git) Untracked() (bool, error) {
-	output, err := g.Call("status", "--branch", "--porcelain")
+func (g *Git) Untracked(ctx context.Context) (bool, error) {
+	p, err := g.parsePorcelain(ctx)
 	if err != nil {
 		return false, err
 	}
+	return p.Untracked > 0, nil
+}
+
+// DirtySubmoduleCountVar :
+func (g *Git) DirtySubmoduleCountVar(ctx context.Context, v *int) error {
+	return intSetter(g.DirtySubmoduleCount(ctx))(v)
+}
+
+// DirtySubmoduleCount counts submodules which have a new commit, modified or untracked files.
+// It follows the StatusFilter as Unstaged does: e.g. with IgnoreSubmodules "dirty" it counts
+// only submodules which have a new commit, and with "all" it counts nothing.
+// It counts nothing with git older than 2.11, which has no "--porcelain=v2".
+func (g *Git) DirtySubmoduleCount(ctx context.Context) (int, error) {
+	p, err := g.parsePorcelain(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return p.DirtySubmodules, nil
+}
+
+// SubmoduleStatus counts submodules with "git submodule status", and checks any of them is
+// out of sync: not initialized, or checked out at a commit other than the one in the index.
+func (g *Git) SubmoduleStatus(ctx context.Context) (count int, outOfSync bool, err error) {
+	if _, err := os.Stat(filepath.Join(g.dir, ".gitmodules")); os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	output, err := g.CallContext(ctx, g.noOptionalLocks(ctx, "submodule", "status")...)
+	if err != nil {
+		return 0, false, err
+	}
 	var line string
 	for lines := scanFunc(output); lines(&line); {
-		if strings.HasPrefix(line, "??") {
-			return true, nil
+		// e.g. " <hash> path (v1.0)", "-<hash> path" (not initialized) or "+<hash> path (heads/main)"
+		if line == "" {
+			continue
+		}
+		count++
+		if line[0] != ' ' {
+			outOfSync = true
 		}
 	}
-	return false, nil
+	return count, outOfSync, nil
+}
+
+// LFSStatusVar :
+func (g *Git) LFSStatusVar(ctx context.Context, v *int) error {
+	return intSetter(g.LFSStatus(ctx))(v)
+}
+
+// LFSStatus counts LFS files changed in the index or the work tree by "git lfs status --porcelain":
+// they are not committed, so not pushed yet.
+// It returns ErrNoLFS if git-lfs is not installed ("git lfs" fails).
+func (g *Git) LFSStatus(ctx context.Context) (int, error) {
+	if _, err := g.CallContext(ctx, "lfs", "version"); isExitError(err) {
+		return 0, ErrNoLFS
+	} else if err != nil {
+		return 0, err
+	}
+	return count(g.CallContext(ctx, "lfs", "status", "--porcelain"))
+}
+
+// IsShallowVar :
+func (g *Git) IsShallowVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.IsShallow(ctx))(v)
+}
+
+// IsShallow checks the repository is a shallow clone.
+func (g *Git) IsShallow(ctx context.Context) (bool, error) {
+	if !g.versionAtLeast(ctx, 2, 15) {
+		// "--is-shallow-repository" is new in 2.15: see the file which lists shallow commits
+		path, err := str(g.CallContext(ctx, "rev-parse", "--git-path", "shallow"))
+		if err != nil {
+			return false, err
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(g.dir, path)
+		}
+		_, err = os.Stat(path)
+		return err == nil, nil
+	}
+	output, err := g.CallContext(ctx, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(bytes.TrimSpace(output), trueBytes), nil
+}
+
+// IsPartialVar :
+func (g *Git) IsPartialVar(ctx context.Context, v *bool) error {
+	return boolSetter(g.IsPartial(ctx))(v)
+}
+
+// IsPartial checks the repository is a partial clone, which has a promisor remote.
+func (g *Git) IsPartial(ctx context.Context) (bool, error) {
+	output, err := strOrEmpty(g.CallContext(ctx, "config", "--get-regexp", `^remote\..*\.(promisor|partialclonefilter)$`))
+	return output != "", err
+}
+
+// DiffStat sums up inserted and deleted lines in the working tree which are not staged.
+// It uses "git diff-files" because "git diff" refreshes the index even without optional locks.
+func (g *Git) DiffStat(ctx context.Context) (insertions, deletions int, err error) {
+	return numstat(g.CallContext(ctx, g.noOptionalLocks(ctx, "diff-files", "--numstat")...))
+}
+
+// StagedDiffStat sums up inserted and deleted lines which are staged.
+// It uses "git diff-index" not to lock the index like DiffStat, and returns zero if the current
+// branch has no commit yet (no HEAD to compare with).
+func (g *Git) StagedDiffStat(ctx context.Context) (insertions, deletions int, err error) {
+	if hasCommits, err := g.HasCommits(ctx); err != nil || !hasCommits {
+		return 0, 0, err
+	}
+	return numstat(g.CallContext(ctx, g.noOptionalLocks(ctx, "diff-index", "--cached", "--numstat", Head)...))
+}
+
+// ConfiguredBaseBranchVar :
+func (g *Git) ConfiguredBaseBranchVar(ctx context.Context, branch string, v *string) error {
+	return stringSetter(g.ConfiguredBaseBranch(ctx, branch))(v)
+}
+
+// ConfiguredBaseBranch gets the base branch configured in "branch.<branch>.gitprompt-base",
+// or in "gitprompt.baseBranch" of the repository (not global) for all branches.
+func (g *Git) ConfiguredBaseBranch(ctx context.Context, branch string) (string, error) {
+	baseBranch, err := strOrEmpty(g.CallContext(ctx, "config", "--get", "branch."+branch+".gitprompt-base"))
+	if err != nil || baseBranch != "" {
+		return baseBranch, err
+	}
+	return strOrEmpty(g.CallContext(ctx, "config", "--local", "--get", "gitprompt.baseBranch"))
 }
 
 // BaseBranchVar :
-func (g *Git) BaseBranchVar(branch string, v *string) error {
-	return stringSetter(g.BaseBranch(branch))(v)
+func (g *Git) BaseBranchVar(ctx context.Context, branch string, v *string) error {
+	return stringSetter(g.BaseBranch(ctx, branch))(v)
+}
+
+// BaseBranch gets the base of the branch: the default branch of the remote of the branch or of origin
+// (refs/remotes/<remote>/HEAD), a remote branch guessed by GuessBaseBranch,
+// or "origin/main" or "origin/master" (see DefaultBranch).
+func (g *Git) BaseBranch(ctx context.Context, branch string) (string, error) {
+	remote, err := g.Remote(ctx, branch)
+	if err != nil {
+		return "", err
+	}
+	for _, remote := range []string{remote, "origin"} {
+		if remote == "" {
+			continue
+		}
+		if baseBranch, err := g.RemoteDefaultBranch(ctx, remote); err != nil || baseBranch != "" {
+			return baseBranch, err
+		}
+	}
+	if baseBranch, err := g.GuessBaseBranch(ctx, branch); err != nil || baseBranch != "" {
+		return baseBranch, err
+	}
+	return g.DefaultBranch(ctx)
+}
+
+// GuessBaseBranchVar :
+func (g *Git) GuessBaseBranchVar(ctx context.Context, branch string, v *string) error {
+	return stringSetter(g.GuessBaseBranch(ctx, branch))(v)
 }
 
-// BaseBranch :
-func (g *Git) BaseBranch(branch string) (string, error) {
-	output, err := g.Call("branch", "-r")
+// GuessBaseBranch guesses the base of the branch from remote branches which prefix the name
+// (e.g. "origin/feature" for "feature/foo" or "feature-foo"). It returns empty if nothing matches.
+func (g *Git) GuessBaseBranch(ctx context.Context, branch string) (string, error) {
+	output, err := g.CallContext(ctx, "branch", "-r")
+	if err != nil {
+		return "", err
+	}
+
+	remotes, err := g.RemoteNames(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -385,39 +889,75 @@ func (g *Git) BaseBranch(branch string) (string, error) {
 	var baseBranch string
 	var line string
 	for lines := scanFunc(output); lines(&line); {
-		remoteFields := strings.SplitN(line, "/", 2) // 不正確: remote-nameやbranch-nameには/が使用できる
-		if len(remoteFields) < 2 {
+		line = strings.TrimSpace(line)
+		_, remoteBranch := splitRemoteRef(remotes, line)
+		if remoteBranch == "" {
 			continue
 		}
-		remoteLength := len(remoteFields[1])
+		remoteLength := len(remoteBranch)
 		if maxMatched > remoteLength {
 			continue
 		}
-		if strings.HasPrefix(branch, remoteFields[1]+"/") {
+		if strings.HasPrefix(branch, remoteBranch+"/") {
 			maxMatched = remoteLength
 			baseBranch = line
-		} else if strings.HasPrefix(branch, remoteFields[1]+"-") {
+		} else if strings.HasPrefix(branch, remoteBranch+"-") {
 			maxMatched = remoteLength
 			baseBranch = line
 		}
 	}
+	return baseBranch, nil
+}
+
+// DefaultBranchVar :
+func (g *Git) DefaultBranchVar(ctx context.Context, v *string) error {
+	return stringSetter(g.DefaultBranch(ctx))(v)
+}
 
-	if baseBranch == "" {
-		return "origin/main", nil
+// DefaultBranch gets the default branch of origin from refs/remotes/origin/HEAD.
+// Without it, it is "origin/main" or "origin/master" which exists, or "origin/main".
+func (g *Git) DefaultBranch(ctx context.Context) (string, error) {
+	if branch, err := g.RemoteDefaultBranch(ctx, "origin"); err != nil || branch != "" {
+		return branch, err
+	}
+	for _, branch := range []string{"origin/main", "origin/master"} {
+		exists, err := g.RefExists(ctx, "refs/remotes/"+branch)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return branch, nil
+		}
 	}
+	return "origin/main", nil
+}
 
-	return strings.TrimSpace(baseBranch), nil
+// RemoteDefaultBranchVar :
+func (g *Git) RemoteDefaultBranchVar(ctx context.Context, remote string, v *string) error {
+	return stringSetter(g.RemoteDefaultBranch(ctx, remote))(v)
 }
 
-func runGit(mod func(*exec.Cmd), args ...string) ([]byte, error) {
-	command := exec.Command("git", args...)
-	if mod != nil {
-		mod(command)
+// RemoteDefaultBranch gets the default branch of the remote like "origin/main" from refs/remotes/<remote>/HEAD.
+// It returns empty if the ref is not set: "git remote set-head <remote> --auto" sets it
+// (the remote is not queried here not to wait for the network in prompts).
+func (g *Git) RemoteDefaultBranch(ctx context.Context, remote string) (string, error) {
+	return strOrEmpty(g.CallContext(ctx, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD"))
+}
+
+// run git in the dir with the options of the Git.
+func (g *Git) run(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
 	}
-	output, err := command.Output()
-	if err != nil {
-		all, _ := command.CombinedOutput()
-		return nil, errors.Wrapf(err, "failed to run git (%q: %q)", strings.Join(args, " "), string(append(output, all...)))
+	path := g.path
+	if path == "" {
+		path = Path
+	}
+	runner := g.runner
+	if runner == nil {
+		runner = DefaultRunner
 	}
-	return output, nil
+	return runGit(ctx, runner, Command{Path: path, Dir: dir, Env: g.envs, Args: args})
 }
@@ -0,0 +1,160 @@
+package git_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/kyoh86/git-prompt/git/testutil"
+)
+
+func TestEmail(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		outputs map[string]string
+		expect  string
+	}{
+		{name: "set", outputs: map[string]string{"config --get user.email": "me@example.com\n"}, expect: "me@example.com"},
+		// "git config" exits with 1 for an unset key, which is not a failure
+		{name: "unset", outputs: map[string]string{}, expect: ""},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			fake := &testutil.FakeRunner{Outputs: map[string]string{openArgs: "true\n/repo\n/repo/.git\n"}}
+			for args, output := range c.outputs {
+				fake.Outputs[args] = output
+			}
+			g, err := git.OpenDir("/repo", git.WithRunner(fake))
+			if err != nil {
+				t.Fatalf("failed to open a fake repository: %s", err)
+			}
+			assertString(t, "Email", c.expect)(g.Email(context.Background()))
+		})
+	}
+}
+
+func TestLFSStatus(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		noLFS  bool
+		status string
+		expect int
+		err    error
+	}{
+		{name: "changed files", status: "M  big.bin\n M data/large.zip\nR  old.bin -> new.bin\n", expect: 3},
+		{name: "no changes", status: "", expect: 0},
+		// "git lfs" exits with 1 for "'lfs' is not a git command"
+		{name: "not installed", noLFS: true, expect: 0, err: git.ErrNoLFS},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			fake := &testutil.FakeRunner{Outputs: map[string]string{
+				openArgs:                 "true\n/repo\n/repo/.git\n",
+				"lfs version":            "git-lfs/3.4.1 (GitHub; linux amd64; go 1.21.5)\n",
+				"lfs status --porcelain": c.status,
+			}}
+			if c.noLFS {
+				delete(fake.Outputs, "lfs version")
+			}
+			g, err := git.OpenDir("/repo", git.WithRunner(fake))
+			if err != nil {
+				t.Fatalf("failed to open a fake repository: %s", err)
+			}
+			count, err := g.LFSStatus(context.Background())
+			if err != c.err {
+				t.Errorf("expect error %v but got %v", c.err, err)
+			}
+			if count != c.expect {
+				t.Errorf("expect %d files but got %d", c.expect, count)
+			}
+		})
+	}
+}
+
+func TestCallShared(t *testing.T) {
+	var mutex sync.Mutex
+	runs := 0
+	release := make(chan struct{})
+	runner := git.RunnerFunc(func(ctx context.Context, cmd git.Command) ([]byte, error) {
+		if strings.Join(cmd.Args, " ") == openArgs {
+			return []byte("true\n/repo\n/repo/.git\n"), nil
+		}
+		mutex.Lock()
+		runs++
+		mutex.Unlock()
+		<-release
+		return []byte("main\n"), nil
+	})
+	g, err := git.OpenDir("/repo", git.WithRunner(runner))
+	if err != nil {
+		t.Fatalf("failed to open a fake repository: %s", err)
+	}
+
+	const callers = 8
+	var wg sync.WaitGroup
+	outputs := make([]string, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			output, err := g.Call("symbolic-ref", "--short", "HEAD")
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			outputs[i] = string(output)
+		}(i)
+	}
+	// let all the callers wait for the running one
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if runs != 1 {
+		t.Errorf("expect git to run once but got %d", runs)
+	}
+	for i, output := range outputs {
+		if output != "main\n" {
+			t.Errorf("caller %d: expect %q but got %q", i, "main\n", output)
+		}
+	}
+}
+
+// TestBranchFast checks the branch is got by "git branch --show-current" on git 2.22+,
+// and by "git symbolic-ref" on older gits which do not know it.
+func TestBranchFast(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		version string
+		outputs map[string]string
+		expect  string
+	}{
+		{name: "show-current", version: "2.39.5", outputs: map[string]string{"branch --show-current": "main\n"}, expect: "main"},
+		{name: "show-current detached", version: "2.39.5", outputs: map[string]string{"branch --show-current": ""}, expect: git.Head},
+		{name: "symbolic-ref", version: "2.20.1", outputs: map[string]string{"symbolic-ref --quiet --short HEAD": "main\n"}, expect: "main"},
+		{name: "symbolic-ref detached", version: "2.20.1", outputs: map[string]string{}, expect: git.Head},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			fake := &testutil.FakeRunner{Outputs: map[string]string{
+				openArgs:    "true\n/repo\n/repo/.git\n",
+				"--version": "git version " + c.version + "\n",
+			}}
+			for args, output := range c.outputs {
+				fake.Outputs[args] = output
+			}
+			g, err := git.OpenDir("/repo", git.WithRunner(fake))
+			if err != nil {
+				t.Fatalf("failed to open a fake repository: %s", err)
+			}
+			assertString(t, "BranchFast", c.expect)(g.BranchFast(context.Background()))
+			for _, call := range fake.Calls() {
+				if call[0] == "branch" && c.version == "2.20.1" {
+					t.Errorf("unexpected call for git %s: %q", c.version, call)
+				}
+			}
+		})
+	}
+}
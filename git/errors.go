@@ -0,0 +1,35 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExitError is returned when git exits with a non-zero status.
+type ExitError struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+	err      error
+}
+
+func (e *ExitError) Error() string {
+	if e.err == nil {
+		// made by a Runner other than ExecRunner
+		return fmt.Sprintf("failed to run git (%q: %q): exit status %d", strings.Join(e.Args, " "), e.Stderr, e.ExitCode)
+	}
+	return fmt.Sprintf("failed to run git (%q: %q): %s", strings.Join(e.Args, " "), e.Stderr, e.err)
+}
+
+// Unwrap returns the original *exec.ExitError (nil if it is not from ExecRunner).
+func (e *ExitError) Unwrap() error {
+	return e.err
+}
+
+// isExitError checks git ran but exited with a non-zero status.
+func isExitError(err error) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr)
+}
@@ -0,0 +1,70 @@
+package git
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Option changes how the Git runs git commands (see OpenDir).
+type Option func(g *Git) error
+
+// WithEnv adds environment variables like "KEY=VALUE" for git commands
+// to the ones of the process. They also take effect in opening the repository (e.g. GIT_DIR).
+func WithEnv(envs ...string) Option {
+	return func(g *Git) error {
+		g.envs = append(g.envs, envs...)
+		return nil
+	}
+}
+
+// WithGitBinary runs the git executable at the path instead of Path.
+func WithGitBinary(path string) Option {
+	return func(g *Git) error {
+		g.path = path
+		return nil
+	}
+}
+
+// WithTimeout gives up each git command running longer than the timeout.
+// A ctx given to the methods limits them in total instead.
+func WithTimeout(timeout time.Duration) Option {
+	return func(g *Git) error {
+		g.timeout = timeout
+		return nil
+	}
+}
+
+// WithUntrackedMode sets how "git status" shows untracked files, like its --untracked-files:
+// "no" hides them, "normal" shows untracked directories and "all" shows each file in them.
+// It is kept by SetStatusFilter with an empty UntrackedMode.
+func WithUntrackedMode(mode string) Option {
+	return func(g *Git) error {
+		switch mode {
+		case "no", "normal", "all":
+			g.statusFilter.UntrackedMode = mode
+		default:
+			return errors.Errorf("invalid untracked mode %q (no, normal or all)", mode)
+		}
+		return nil
+	}
+}
+
+// WithRunner runs git commands of the Git by the runner instead of DefaultRunner.
+func WithRunner(runner Runner) Option {
+	return func(g *Git) error {
+		g.runner = runner
+		return nil
+	}
+}
+
+// getenv gets the value of the environment variable for git commands.
+func (g *Git) getenv(name string) string {
+	for i := len(g.envs) - 1; i >= 0; i-- {
+		if strings.HasPrefix(g.envs[i], name+"=") {
+			return strings.TrimPrefix(g.envs[i], name+"=")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,268 @@
+package git
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+const (
+	branchPrefix     = "## "
+	branchInitPrefix = branchPrefix + "No commits yet on "
+	branchDetached   = branchPrefix + "HEAD (no branch)"
+)
+
+var (
+	branchRegexp = regexp.MustCompile(`^## (\S+)\.\.\.(\S+/\S+)(?: \[(?:ahead (\d+))?(?:, )?(?:behind (\d+))?(gone)?\])?$`)
+)
+
+// porcelain holds statuses parsed from "git status --branch --porcelain=v2"
+// (or "--porcelain" for git older than 2.11, which leaves DirtySubmodules zero).
+type porcelain struct {
+	Branch       string
+	Upstream     string
+	UpstreamGone bool
+	Ahead        int
+	Behind       int
+	NoCommits    bool
+
+	Staged     int
+	Unstaged   int
+	Untracked  int
+	Conflicted int
+
+	DirtySubmodules int
+}
+
+// StatusFilter filters files which "git status" reports.
+type StatusFilter struct {
+	// UntrackedMode is passed as --untracked-files: "no" hides untracked files,
+	// "normal" shows untracked directories and "all" shows each file in them.
+	// Empty keeps the mode given by WithUntrackedMode ("normal" by default).
+	UntrackedMode string
+	// IgnoreSubmodules is passed as --ignore-submodules (none, untracked, dirty or all).
+	// Empty follows the config of git (e.g. submodule.<name>.ignore).
+	IgnoreSubmodules string
+	// Excludes are pathspecs (relative to the root) of files to hide (e.g. "vendor/*").
+	Excludes []string
+}
+
+// SetStatusFilter sets the filter for Staged, Unstaged, Untracked, ConflictCount,
+// DirtySubmoduleCount and Porcelain.
+// It should be set before they are called, because the status is read once.
+func (g *Git) SetStatusFilter(filter StatusFilter) {
+	if filter.UntrackedMode == "" {
+		filter.UntrackedMode = g.statusFilter.UntrackedMode
+	}
+	g.statusFilter = filter
+}
+
+// UntrackedMode gets how "git status" shows untracked files: "no", "normal" or "all".
+func (g *Git) UntrackedMode() string {
+	if g.statusFilter.UntrackedMode == "" {
+		return "normal"
+	}
+	return g.statusFilter.UntrackedMode
+}
+
+// statusArgs builds arguments of "git status --branch" in the format (e.g. "--porcelain=v2") with the filter.
+func (g *Git) statusArgs(ctx context.Context, format string) []string {
+	args := g.noOptionalLocks(ctx, "status", "--branch", format)
+	if mode := g.statusFilter.UntrackedMode; mode != "" && mode != "normal" {
+		args = append(args, "--untracked-files="+mode)
+	}
+	if g.statusFilter.IgnoreSubmodules != "" {
+		args = append(args, "--ignore-submodules="+g.statusFilter.IgnoreSubmodules)
+	}
+	if len(g.statusFilter.Excludes) > 0 {
+		args = append(args, "--")
+		for _, exclude := range g.statusFilter.Excludes {
+			args = append(args, ":(exclude)"+exclude)
+		}
+	}
+	return args
+}
+
+// parsePorcelain calls "git status" once and parses it.
+func (g *Git) parsePorcelain(ctx context.Context) (*porcelain, error) {
+	g.porcelainOnce.Do(func() {
+		if !g.versionAtLeast(ctx, 2, 11) {
+			output, err := g.CallContext(ctx, g.statusArgs(ctx, "--porcelain")...)
+			if err != nil {
+				g.porcelainErr = err
+				return
+			}
+			g.porcelain, g.porcelainErr = parsePorcelain(output)
+			return
+		}
+		output, err := g.CallContext(ctx, g.statusArgs(ctx, "--porcelain=v2")...)
+		if err != nil {
+			g.porcelainErr = err
+			return
+		}
+		g.porcelain, g.porcelainErr = parsePorcelainV2(output)
+	})
+	return g.porcelain, g.porcelainErr
+}
+
+// PorcelainVar :
+func (g *Git) PorcelainVar(ctx context.Context, v *string) error {
+	return stringSetter(g.Porcelain(ctx))(v)
+}
+
+// Porcelain gets the raw output of "git status --branch --porcelain" with the filter.
+func (g *Git) Porcelain(ctx context.Context) (string, error) {
+	output, err := g.CallContext(ctx, g.statusArgs(ctx, "--porcelain")...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+func parsePorcelain(output []byte) (*porcelain, error) {
+	var p porcelain
+	var line string
+	lines := scanFunc(output)
+	if !lines(&line) {
+		return &p, nil
+	}
+	if err := p.parseBranch(line); err != nil {
+		return nil, err
+	}
+	for lines(&line) {
+		p.parseEntry(line)
+	}
+	return &p, nil
+}
+
+func (p *porcelain) parseBranch(line string) error {
+	switch {
+	case !strings.HasPrefix(line, branchPrefix):
+		p.parseEntry(line)
+	case strings.HasPrefix(line, branchInitPrefix):
+		// an unborn branch may have an upstream like "No commits yet on main...origin/main [gone]"
+		p.Branch = strings.SplitN(strings.TrimPrefix(line, branchInitPrefix), "...", 2)[0]
+		p.NoCommits = true
+	case line == branchDetached:
+		p.Branch = Head
+	default:
+		matches := branchRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			p.Branch = strings.TrimPrefix(line, branchPrefix)
+			return nil
+		}
+		p.Branch = matches[1]
+		p.Upstream = matches[2]
+		p.UpstreamGone = matches[5] != ""
+		var err error
+		if p.Ahead, err = parseInt32(matches[3]); err != nil {
+			return err
+		}
+		if p.Behind, err = parseInt32(matches[4]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseEntry counts an entry formed like "XY PATH" or "XY ORIG_PATH -> PATH".
+// A renamed or copied entry is a single line, so it is counted once.
+func (p *porcelain) parseEntry(line string) {
+	if len(line) < 2 {
+		return
+	}
+	switch x, y := line[0], line[1]; {
+	case x == '?' && y == '?':
+		p.Untracked++
+	case x == '!' && y == '!':
+		// ignored
+	case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+		p.Conflicted++
+	default:
+		switch x {
+		case 'M', 'T', 'A', 'D', 'R', 'C':
+			p.Staged++
+		}
+		switch y {
+		case 'M', 'T', 'D', 'R', 'C':
+			p.Unstaged++
+		}
+	}
+}
+
+// parsePorcelainV2 parses the output of "git status --branch --porcelain=v2".
+func parsePorcelainV2(output []byte) (*porcelain, error) {
+	var p porcelain
+	var line string
+	var hasAheadBehind bool
+	for lines := scanFunc(output); lines(&line); {
+		if strings.HasPrefix(line, "# ") {
+			// headers like "# branch.head main"
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[1] {
+			case "branch.oid":
+				p.NoCommits = fields[2] == "(initial)"
+			case "branch.head":
+				p.Branch = fields[2]
+				if p.Branch == "(detached)" {
+					p.Branch = Head
+				}
+			case "branch.upstream":
+				p.Upstream = fields[2]
+			case "branch.ab":
+				// e.g. "# branch.ab +1 -2"
+				if len(fields) < 4 {
+					continue
+				}
+				hasAheadBehind = true
+				var err error
+				if p.Ahead, err = parseInt32(strings.TrimPrefix(fields[2], "+")); err != nil {
+					return nil, err
+				}
+				if p.Behind, err = parseInt32(strings.TrimPrefix(fields[3], "-")); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		p.parseEntryV2(line)
+	}
+	// the upstream is configured but the branch is not found in the remote
+	p.UpstreamGone = p.Upstream != "" && !hasAheadBehind && !p.NoCommits
+	return &p, nil
+}
+
+// parseEntryV2 counts an entry formed like "1 XY SUB ...", "2 XY SUB ...", "u XY ..." or "? PATH".
+// X and Y are "." if they are not changed.
+func (p *porcelain) parseEntryV2(line string) {
+	if len(line) < 2 {
+		return
+	}
+	switch line[0] {
+	case '?':
+		p.Untracked++
+	case 'u':
+		p.Conflicted++
+	case '1', '2':
+		// e.g. "1 .M S.M. 160000 160000 160000 <hash> <hash> <path>"
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 || len(fields[1]) != 2 {
+			return
+		}
+		switch fields[1][0] {
+		case 'M', 'T', 'A', 'D', 'R', 'C':
+			p.Staged++
+		}
+		switch fields[1][1] {
+		case 'M', 'T', 'D', 'R', 'C':
+			p.Unstaged++
+		}
+		// a submodule has a new commit, modified or untracked files
+		if sub := fields[2]; sub[0] == 'S' && sub != "S..." {
+			p.DirtySubmodules++
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package git_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/kyoh86/git-prompt/git/testutil"
+)
+
+const (
+	openArgs     = "rev-parse --is-inside-work-tree --show-toplevel --absolute-git-dir"
+	statusV2Args = "--no-optional-locks status --branch --porcelain=v2"
+	statusV1Args = "status --branch --porcelain"
+)
+
+// fakeGit is a version of git to fake, and the arguments of "git status" which it is called with.
+type fakeGit struct {
+	version    string
+	statusArgs string
+}
+
+var (
+	gitV2 = fakeGit{version: "2.39.5", statusArgs: statusV2Args}
+	// older than 2.11 reads the status as --porcelain (v1)
+	gitV1 = fakeGit{version: "2.9.5", statusArgs: statusV1Args}
+)
+
+// openFake opens a fake repository of the git which answers the output of "git status".
+func openFake(t *testing.T, fake fakeGit, status string) *git.Git {
+	t.Helper()
+	runner := &testutil.FakeRunner{Outputs: map[string]string{
+		openArgs:        "true\n/repo\n/repo/.git\n",
+		"--version":     "git version " + fake.version + "\n",
+		fake.statusArgs: status,
+	}}
+	g, err := git.OpenDir("/repo", git.WithRunner(runner))
+	if err != nil {
+		t.Fatalf("failed to open a fake repository: %s", err)
+	}
+	return g
+}
+
+// statusCase is an expected result of parsing the status.
+type statusCase struct {
+	name                                  string
+	git                                   fakeGit
+	status                                string
+	branch, upstream                      string
+	gone, hasCommits                      bool
+	ahead, behind                         int
+	staged, unstaged, untracked, conflict int
+	dirtySubmodules                       int
+}
+
+func TestStatus(t *testing.T) {
+	for _, c := range []statusCase{
+		{
+			name: "diverged branch v2",
+			git:  gitV2,
+			status: "# branch.oid 1234567890abcdef1234567890abcdef12345678\n" +
+				"# branch.head main\n" +
+				"# branch.upstream origin/main\n" +
+				"# branch.ab +2 -1\n" +
+				"1 M. N... 100644 100644 100644 aaaaaaa bbbbbbb staged.go\n" +
+				"1 .M N... 100644 100644 100644 aaaaaaa aaaaaaa unstaged.go\n" +
+				"? new.go\n",
+			branch: "main", upstream: "origin/main", hasCommits: true,
+			ahead: 2, behind: 1, staged: 1, unstaged: 1, untracked: 1,
+		},
+		{
+			name: "diverged branch v1",
+			git:  gitV1,
+			status: "## main...origin/main [ahead 2, behind 1]\n" +
+				"M  staged.go\n" +
+				" M unstaged.go\n" +
+				"?? new.go\n",
+			branch: "main", upstream: "origin/main", hasCommits: true,
+			ahead: 2, behind: 1, staged: 1, unstaged: 1, untracked: 1,
+		},
+		{
+			name: "gone upstream v2",
+			git:  gitV2,
+			status: "# branch.oid 1234567890abcdef1234567890abcdef12345678\n" +
+				"# branch.head feat\n" +
+				"# branch.upstream origin/feat\n",
+			branch: "feat", upstream: "origin/feat", gone: true, hasCommits: true,
+		},
+		{
+			name:   "gone upstream v1",
+			git:    gitV1,
+			status: "## feat...origin/feat [gone]\n",
+			branch: "feat", upstream: "origin/feat", gone: true, hasCommits: true,
+		},
+		{
+			name: "unborn branch v2",
+			git:  gitV2,
+			status: "# branch.oid (initial)\n" +
+				"# branch.head main\n" +
+				"# branch.upstream origin/main\n" +
+				"? new.go\n",
+			branch: "main", upstream: "origin/main", untracked: 1,
+		},
+		{
+			name:   "unborn branch v1",
+			git:    gitV1,
+			status: "## No commits yet on main\n?? new.go\n",
+			branch: "main", untracked: 1,
+		},
+		{
+			name: "detached HEAD v2",
+			git:  gitV2,
+			status: "# branch.oid 1234567890abcdef1234567890abcdef12345678\n" +
+				"# branch.head (detached)\n",
+			branch: git.Head, hasCommits: true,
+		},
+		{
+			name:   "detached HEAD v1",
+			git:    gitV1,
+			status: "## HEAD (no branch)\n",
+			branch: git.Head, hasCommits: true,
+		},
+		{
+			name: "conflicts v2",
+			git:  gitV2,
+			status: "# branch.oid 1234567890abcdef1234567890abcdef12345678\n" +
+				"# branch.head main\n" +
+				"u UU N... 100644 100644 100644 100644 aaaaaaa bbbbbbb ccccccc both.go\n" +
+				"u AA N... 000000 100644 100644 100644 0000000 bbbbbbb ccccccc added.go\n" +
+				"1 M. N... 100644 100644 100644 aaaaaaa bbbbbbb resolved.go\n",
+			branch: "main", hasCommits: true, conflict: 2, staged: 1,
+		},
+		{
+			name:   "conflicts v1",
+			git:    gitV1,
+			status: "## main\nUU both.go\nAA added.go\nDD deleted.go\nM  resolved.go\n",
+			branch: "main", hasCommits: true, conflict: 3, staged: 1,
+		},
+		{
+			name: "submodule v2",
+			git:  gitV2,
+			status: "# branch.oid 1234567890abcdef1234567890abcdef12345678\n" +
+				"# branch.head main\n" +
+				"1 .M S.M. 160000 160000 160000 aaaaaaa aaaaaaa dirty\n" +
+				"1 .M SC.. 160000 160000 160000 aaaaaaa aaaaaaa moved\n" +
+				"1 A. S... 000000 160000 160000 0000000 aaaaaaa added\n",
+			branch: "main", hasCommits: true, staged: 1, unstaged: 2, dirtySubmodules: 2,
+		},
+		{
+			name: "staged rename v2",
+			git:  gitV2,
+			status: "# branch.oid 1234567890abcdef1234567890abcdef12345678\n" +
+				"# branch.head main\n" +
+				"2 R. N... 100644 100644 100644 aaaaaaa aaaaaaa R100 new.go\told.go\n",
+			branch: "main", hasCommits: true, staged: 1,
+		},
+		{
+			name:   "staged rename v1",
+			git:    gitV1,
+			status: "## main\nR  old.go -> new.go\n",
+			branch: "main", hasCommits: true, staged: 1,
+		},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			g := openFake(t, c.git, c.status)
+			assertString(t, "Branch", c.branch)(g.Branch(context.Background()))
+			assertString(t, "Upstream", c.upstream)(g.Upstream(context.Background()))
+			assertBool(t, "UpstreamGone", c.gone)(g.UpstreamGone(context.Background()))
+			assertBool(t, "HasCommits", c.hasCommits)(g.HasCommits(context.Background()))
+			assertInt(t, "AheadCount", c.ahead)(g.AheadCount(context.Background()))
+			assertInt(t, "BehindCount", c.behind)(g.BehindCount(context.Background()))
+			assertInt(t, "StagedCount", c.staged)(g.StagedCount(context.Background()))
+			assertInt(t, "UnstagedCount", c.unstaged)(g.UnstagedCount(context.Background()))
+			assertInt(t, "UntrackedCount", c.untracked)(g.UntrackedCount(context.Background()))
+			assertInt(t, "ConflictCount", c.conflict)(g.ConflictCount(context.Background()))
+			assertInt(t, "DirtySubmoduleCount", c.dirtySubmodules)(g.DirtySubmoduleCount(context.Background()))
+		})
+	}
+}
+
+func assertString(t *testing.T, name, expect string) func(string, error) {
+	t.Helper()
+	return func(actual string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		} else if actual != expect {
+			t.Errorf("%s: expect %q but got %q", name, expect, actual)
+		}
+	}
+}
+
+func assertBool(t *testing.T, name string, expect bool) func(bool, error) {
+	t.Helper()
+	return func(actual bool, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		} else if actual != expect {
+			t.Errorf("%s: expect %t but got %t", name, expect, actual)
+		}
+	}
+}
+
+func assertInt(t *testing.T, name string, expect int) func(int, error) {
+	t.Helper()
+	return func(actual int, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", name, err)
+		} else if actual != expect {
+			t.Errorf("%s: expect %d but got %d", name, expect, actual)
+		}
+	}
+}
+
+func TestUntrackedMode(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		option string
+		filter string
+		expect string
+		args   string
+	}{
+		{name: "default", expect: "normal", args: statusV2Args},
+		{name: "option", option: "all", expect: "all", args: statusV2Args + " --untracked-files=all"},
+		{name: "option kept by filter", option: "no", expect: "no", args: statusV2Args + " --untracked-files=no"},
+		{name: "filter over option", option: "no", filter: "all", expect: "all", args: statusV2Args + " --untracked-files=all"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			fake := &testutil.FakeRunner{Outputs: map[string]string{
+				openArgs:    "true\n/repo\n/repo/.git\n",
+				"--version": "git version 2.39.5\n",
+				c.args:      "# branch.oid (initial)\n# branch.head main\n? new.go\n",
+			}}
+			opts := []git.Option{git.WithRunner(fake)}
+			if c.option != "" {
+				opts = append(opts, git.WithUntrackedMode(c.option))
+			}
+			g, err := git.OpenDir("/repo", opts...)
+			if err != nil {
+				t.Fatalf("failed to open a fake repository: %s", err)
+			}
+			g.SetStatusFilter(git.StatusFilter{UntrackedMode: c.filter})
+			if actual := g.UntrackedMode(); actual != c.expect {
+				t.Errorf("expect mode %q but got %q", c.expect, actual)
+			}
+			assertInt(t, "UntrackedCount", 1)(g.UntrackedCount(context.Background()))
+		})
+	}
+}
+
+// TestDiffStat checks the diff stats are got by the plumbing commands without optional locks.
+func TestDiffStat(t *testing.T) {
+	const (
+		diffFilesArgs = "--no-optional-locks diff-files --numstat"
+		diffIndexArgs = "--no-optional-locks diff-index --cached --numstat HEAD"
+	)
+	for _, c := range []struct {
+		name                              string
+		status                            string
+		diffFiles, diffIndex              string
+		insertions, deletions             int
+		stagedInsertions, stagedDeletions int
+	}{
+		{
+			name:       "committed",
+			status:     "# branch.oid 1234567890abcdef1234567890abcdef12345678\n# branch.head main\n",
+			diffFiles:  "2\t1\ta.go\n",
+			diffIndex:  "3\t1\tb.go\n-\t-\timage.png\n4\t0\tc.go\n",
+			insertions: 2, deletions: 1,
+			stagedInsertions: 7, stagedDeletions: 1,
+		},
+		{
+			name:      "unborn",
+			status:    "# branch.oid (initial)\n# branch.head main\n",
+			diffFiles: "",
+		},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			fake := &testutil.FakeRunner{Outputs: map[string]string{
+				openArgs:      "true\n/repo\n/repo/.git\n",
+				"--version":   "git version " + gitV2.version + "\n",
+				statusV2Args:  c.status,
+				diffFilesArgs: c.diffFiles,
+			}}
+			if c.diffIndex != "" {
+				fake.Outputs[diffIndexArgs] = c.diffIndex
+			}
+			g, err := git.OpenDir("/repo", git.WithRunner(fake))
+			if err != nil {
+				t.Fatalf("failed to open a fake repository: %s", err)
+			}
+			ctx := context.Background()
+			insertions, deletions, err := g.DiffStat(ctx)
+			if err != nil || insertions != c.insertions || deletions != c.deletions {
+				t.Errorf("expect +%d -%d but got +%d -%d (%v)", c.insertions, c.deletions, insertions, deletions, err)
+			}
+			insertions, deletions, err = g.StagedDiffStat(ctx)
+			if err != nil || insertions != c.stagedInsertions || deletions != c.stagedDeletions {
+				t.Errorf("expect staged +%d -%d but got +%d -%d (%v)", c.stagedInsertions, c.stagedDeletions, insertions, deletions, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package git_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git/testutil"
+)
+
+// TestRemote checks fallbacks of Remote for a fresh local branch without upstream.
+func TestRemote(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		remotes []string
+		config  [][]string
+		expect  string
+	}{
+		{name: "origin", remotes: []string{"upstream", "origin"}, expect: "origin"},
+		{name: "pushDefault", remotes: []string{"upstream", "origin"}, config: [][]string{{"remote.pushDefault", "upstream"}}, expect: "upstream"},
+		{name: "single remote", remotes: []string{"fork"}, expect: "fork"},
+		{name: "no remote to choose", remotes: []string{"fork", "upstream"}, expect: ""},
+		{name: "no remote", expect: ""},
+		{name: "branch remote", remotes: []string{"fork", "origin"}, config: [][]string{{"branch.feat.remote", "fork"}, {"remote.pushDefault", "origin"}}, expect: "fork"},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			r := testutil.NewRepo(t)
+			defer r.Remove()
+			r.Commit("first")
+			r.Checkout("feat", true)
+			for _, remote := range c.remotes {
+				r.Git("remote", "add", remote, "https://example.com/"+remote+"/repo.git")
+			}
+			for _, config := range c.config {
+				r.Git(append([]string{"config"}, config...)...)
+			}
+			if remote, err := r.Open().Remote(context.Background(), "feat"); err != nil || remote != c.expect {
+				t.Errorf("expect the remote %q but got %q (%v)", c.expect, remote, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Command is a git command to be run by the Runner.
+type Command struct {
+	Path string   // git executable
+	Dir  string   // working directory
+	Env  []string // nil for the environment of the process
+	Args []string // arguments without the executable
+}
+
+// Runner runs git commands for the Git and the functions of this package.
+// A fake of it can simulate outputs of git without a repository (e.g. in tests).
+//
+// It should return an *ExitError if git exits with a non-zero status,
+// which means "not found" or so for many methods.
+type Runner interface {
+	Run(ctx context.Context, cmd Command) ([]byte, error)
+}
+
+// RunnerFunc is a function as a Runner.
+type RunnerFunc func(ctx context.Context, cmd Command) ([]byte, error)
+
+// Run calls the function.
+func (f RunnerFunc) Run(ctx context.Context, cmd Command) ([]byte, error) {
+	return f(ctx, cmd)
+}
+
+// DefaultRunner runs git commands for the Git opened without WithRunner,
+// and for the functions of this package (e.g. GitDir).
+var DefaultRunner Runner = ExecRunner{}
+
+// ExecRunner runs git commands as processes.
+type ExecRunner struct{}
+
+// Run the git command. When the ctx is done, it is killed.
+func (ExecRunner) Run(ctx context.Context, cmd Command) ([]byte, error) {
+	command := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
+	command.Dir = cmd.Dir
+	command.Env = cmd.Env
+	output, err := command.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			// killed by the context: it is not an exit error which means "not found" or so
+			return nil, errors.Wrapf(ctx.Err(), "failed to run git (%q)", strings.Join(cmd.Args, " "))
+		}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, &ExitError{
+				Args:     cmd.Args,
+				ExitCode: exitErr.ExitCode(),
+				Stderr:   string(bytes.TrimSpace(exitErr.Stderr)),
+				err:      err,
+			}
+		}
+		return nil, errors.Wrapf(err, "failed to run git (%q)", strings.Join(cmd.Args, " "))
+	}
+	return output, nil
+}
+
+// runGit runs the command by the runner, recording its duration.
+func runGit(ctx context.Context, runner Runner, cmd Command) ([]byte, error) {
+	if RecordTiming {
+		defer recordTiming(cmd.Args, time.Now())
+	}
+	return runner.Run(ctx, cmd)
+}
+
+// runIn runs git in the dir by the DefaultRunner for the functions of this package.
+func runIn(dir string, args ...string) ([]byte, error) {
+	return runGit(context.Background(), DefaultRunner, Command{Path: Path, Dir: dir, Args: args})
+}
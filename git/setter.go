@@ -29,3 +29,23 @@ func stringSetter(r string, err error) func(v *string) error {
 		return nil
 	}
 }
+
+func stringsSetter(r []string, err error) func(v *[]string) error {
+	if err != nil {
+		return func(*[]string) error { return err }
+	}
+	return func(v *[]string) error {
+		*v = r
+		return nil
+	}
+}
+
+func stringMapSetter(r map[string]string, err error) func(v *map[string]string) error {
+	if err != nil {
+		return func(*map[string]string) error { return err }
+	}
+	return func(v *map[string]string) error {
+		*v = r
+		return nil
+	}
+}
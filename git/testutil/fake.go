@@ -0,0 +1,42 @@
+package testutil
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/kyoh86/git-prompt/git"
+)
+
+// FakeRunner is a git.Runner which answers outputs by the arguments without running git.
+// Give it to git.WithRunner, or set it to git.DefaultRunner for the functions of the package.
+type FakeRunner struct {
+	// Outputs of git commands by their arguments joined with spaces (e.g. "rev-parse --git-dir").
+	// Commands not in it exit with the status 1 like "not found".
+	Outputs map[string]string
+
+	mutex sync.Mutex
+	calls [][]string
+}
+
+// Run answers the output for the arguments of the command.
+func (f *FakeRunner) Run(ctx context.Context, cmd git.Command) ([]byte, error) {
+	f.mutex.Lock()
+	f.calls = append(f.calls, cmd.Args)
+	f.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	output, ok := f.Outputs[strings.Join(cmd.Args, " ")]
+	if !ok {
+		return nil, &git.ExitError{Args: cmd.Args, ExitCode: 1}
+	}
+	return []byte(output), nil
+}
+
+// Calls lists arguments of the commands which have been run.
+func (f *FakeRunner) Calls() [][]string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([][]string(nil), f.calls...)
+}
@@ -0,0 +1,113 @@
+// Package testutil builds temporary git repositories for tests.
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git"
+)
+
+// Repo is a temporary repository. Any failure of its methods fails the test.
+type Repo struct {
+	t   testing.TB
+	Dir string
+}
+
+// NewRepo initializes a repository in a temporary directory on the branch "main".
+// Call Remove to remove it after the test.
+func NewRepo(t testing.TB) *Repo {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "git-prompt-test")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err)
+	}
+	r := &Repo{t: t, Dir: dir}
+	r.Git("init", "--quiet")
+	r.Git("symbolic-ref", "HEAD", "refs/heads/main")
+	r.Git("config", "user.name", "tester")
+	r.Git("config", "user.email", "tester@example.com")
+	return r
+}
+
+// Remove the repository and the remotes added by AddRemote.
+func (r *Repo) Remove() {
+	if err := os.RemoveAll(r.Dir); err != nil {
+		r.t.Errorf("failed to remove %s: %s", r.Dir, err)
+	}
+}
+
+// Git runs git in the repository and returns the output without the trailing newline.
+func (r *Repo) Git(args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("failed to run git %s: %s\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimRight(string(output), "\n")
+}
+
+// WriteFile writes the content to the file in the repository, making its directory.
+func (r *Repo) WriteFile(name, content string) {
+	r.t.Helper()
+	path := filepath.Join(r.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		r.t.Fatalf("failed to make a directory for %s: %s", name, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		r.t.Fatalf("failed to write %s: %s", name, err)
+	}
+}
+
+// Commit all changes in the work tree (or an empty commit) with the message.
+func (r *Repo) Commit(message string) {
+	r.t.Helper()
+	r.Git("add", "--all")
+	r.Git("commit", "--quiet", "--allow-empty", "--message", message)
+}
+
+// Checkout the branch, creating it from the HEAD if create is true.
+func (r *Repo) Checkout(branch string, create bool) {
+	r.t.Helper()
+	if create {
+		r.Git("checkout", "--quiet", "-b", branch)
+		return
+	}
+	r.Git("checkout", "--quiet", branch)
+}
+
+// Stash changes in the work tree.
+func (r *Repo) Stash() {
+	r.t.Helper()
+	r.Git("stash", "push", "--quiet", "--include-untracked")
+}
+
+// AddRemote makes a bare repository in the directory of the repository and adds it
+// as the remote. Push to it with r.Git("push", ...) to make remote branches.
+func (r *Repo) AddRemote(name string) string {
+	r.t.Helper()
+	dir := filepath.Join(r.Dir, ".git", "test-remotes", name)
+	cmd := exec.Command("git", "init", "--quiet", "--bare", dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		r.t.Fatalf("failed to init the remote %s: %s\n%s", name, err, output)
+	}
+	r.Git("remote", "add", name, dir)
+	return dir
+}
+
+// Open the repository with the git package.
+func (r *Repo) Open() *git.Git {
+	r.t.Helper()
+	g, err := git.OpenDir(r.Dir)
+	if err != nil {
+		r.t.Fatalf("failed to open the repository: %s", err)
+	}
+	return g
+}
@@ -0,0 +1,40 @@
+package testutil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git/testutil"
+)
+
+func TestRepo(t *testing.T) {
+	r := testutil.NewRepo(t)
+	defer r.Remove()
+	r.WriteFile("dir/file.txt", "first\n")
+	r.Commit("first")
+	r.Checkout("feat", true)
+	r.AddRemote("origin")
+	r.Git("push", "--quiet", "--set-upstream", "origin", "feat")
+	r.WriteFile("dir/file.txt", "second\n")
+	r.Stash()
+
+	g := r.Open()
+	if branch, err := g.Branch(context.Background()); err != nil || branch != "feat" {
+		t.Errorf("expect the branch feat but got %q (%v)", branch, err)
+	}
+	if upstream, err := g.Upstream(context.Background()); err != nil || upstream != "origin/feat" {
+		t.Errorf("expect the upstream origin/feat but got %q (%v)", upstream, err)
+	}
+	if count, err := g.CommitCount(context.Background()); err != nil || count != 1 {
+		t.Errorf("expect 1 commit but got %d (%v)", count, err)
+	}
+	if count, err := g.StashCount(context.Background()); err != nil || count != 1 {
+		t.Errorf("expect 1 stash but got %d (%v)", count, err)
+	}
+	if unstaged, err := g.Unstaged(context.Background()); err != nil || unstaged {
+		t.Errorf("expect the stashed change not to be in the work tree (%v)", err)
+	}
+	if remotes, err := g.RemoteNames(context.Background()); err != nil || len(remotes) != 1 || remotes[0] != "origin" {
+		t.Errorf("expect the remote origin but got %q (%v)", remotes, err)
+	}
+}
@@ -0,0 +1,34 @@
+package git
+
+import (
+	"sync"
+	"time"
+)
+
+// Timing is a duration spent by a git invocation.
+type Timing struct {
+	Args     []string
+	Duration time.Duration
+}
+
+var (
+	// RecordTiming enables to record durations of each git invocation.
+	RecordTiming bool
+
+	timingMutex sync.Mutex
+	timings     []Timing
+)
+
+func recordTiming(args []string, start time.Time) {
+	duration := time.Since(start)
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+	timings = append(timings, Timing{Args: args, Duration: duration})
+}
+
+// Timings gets durations recorded while RecordTiming is enabled.
+func Timings() []Timing {
+	timingMutex.Lock()
+	defer timingMutex.Unlock()
+	return append([]Timing(nil), timings...)
+}
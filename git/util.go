@@ -4,8 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"strings"
-
-	"github.com/pkg/errors"
 )
 
 func scanFunc(buf []byte) func(*string) bool {
@@ -24,7 +22,7 @@ func scanner(buf []byte) *bufio.Scanner {
 }
 
 func strOrEmpty(buf []byte, err error) (string, error) {
-	if err != nil && strings.HasPrefix(errors.Cause(err).Error(), "exit status ") {
+	if isExitError(err) {
 		err = nil
 	}
 	return str(buf, err)
@@ -33,11 +31,30 @@ func str(buf []byte, err error) (string, error) {
 	return string(bytes.TrimSpace(buf)), err
 }
 
-func countOrZero(buf []byte, err error) (int, error) {
-	if err != nil && strings.HasPrefix(errors.Cause(err).Error(), "exit status ") {
-		err = nil
+func lines(buf []byte, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	list := []string{}
+	var line string
+	for scan := scanFunc(buf); scan(&line); {
+		list = append(list, line)
+	}
+	return list, nil
+}
+
+func numberOrZero(buf []byte, err error) (int, error) {
+	if isExitError(err) {
+		return 0, nil
+	}
+	return number(buf, err)
+}
+
+func number(buf []byte, err error) (int, error) {
+	if err != nil {
+		return 0, err
 	}
-	return count(buf, err)
+	return parseInt32(string(bytes.TrimSpace(buf)))
 }
 
 func count(buf []byte, err error) (int, error) {
@@ -51,3 +68,29 @@ func count(buf []byte, err error) (int, error) {
 	}
 	return count, nil
 }
+
+// numstat sums up the output of "git diff --numstat".
+// Binary files ("-	-	path") are counted as zero.
+func numstat(buf []byte, err error) (insertions, deletions int, _ error) {
+	if err != nil {
+		return 0, 0, err
+	}
+	var line string
+	for lines := scanFunc(buf); lines(&line); {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 || fields[0] == "-" {
+			continue
+		}
+		added, err := parseInt32(fields[0])
+		if err != nil {
+			return 0, 0, err
+		}
+		deleted, err := parseInt32(fields[1])
+		if err != nil {
+			return 0, 0, err
+		}
+		insertions += added
+		deletions += deleted
+	}
+	return insertions, deletions, nil
+}
@@ -0,0 +1,62 @@
+package git
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+var versionRegexp = regexp.MustCompile(`^git version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// version is the parsed version of git. Unknown parts are zero.
+type version struct {
+	major, minor, patch int
+}
+
+// VersionVar :
+func (g *Git) VersionVar(ctx context.Context, v *string) error {
+	return stringSetter(g.Version(ctx))(v)
+}
+
+// Version gets the version of git (e.g. "2.39.5") from "git --version".
+// It is called once for the Git, and the parsed one chooses arguments for old gits.
+func (g *Git) Version(ctx context.Context) (string, error) {
+	g.versionOnce.Do(func() {
+		output, err := str(g.CallContext(ctx, "--version"))
+		if err != nil {
+			g.versionErr = err
+			return
+		}
+		// e.g. "git version 2.39.5", "git version 2.37.1 (Apple Git-137.1)" or "git version 2.40.0.windows.1"
+		g.versionText = strings.TrimPrefix(strings.SplitN(output, " (", 2)[0], "git version ")
+		matches := versionRegexp.FindStringSubmatch(output)
+		if matches == nil {
+			return
+		}
+		g.version.major, _ = parseInt32(matches[1])
+		g.version.minor, _ = parseInt32(matches[2])
+		g.version.patch, _ = parseInt32(matches[3])
+	})
+	return g.versionText, g.versionErr
+}
+
+// versionAtLeast checks git is newer than or equal to the major.minor.
+// It assumes a new git if the version is unknown, not to lose features on an unusual build.
+func (g *Git) versionAtLeast(ctx context.Context, major, minor int) bool {
+	if _, err := g.Version(ctx); err != nil || g.version == (version{}) {
+		return true
+	}
+	if g.version.major != major {
+		return g.version.major > major
+	}
+	return g.version.minor >= minor
+}
+
+// noOptionalLocks returns "--no-optional-locks" to prefix arguments if git supports it (2.15+).
+// Older gits may refresh the index in "git status" instead.
+func (g *Git) noOptionalLocks(ctx context.Context, args ...string) []string {
+	if !g.versionAtLeast(ctx, 2, 15) {
+		return args
+	}
+	return append([]string{"--no-optional-locks"}, args...)
+}
@@ -1,14 +1,120 @@
 package git
 
-import "bytes"
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
 
 var trueBytes = []byte("true")
 
-// IsWorking will check the current directory is inside work tree.
-func IsWorking() (bool, error) {
-	output, err := runGit(nil, "rev-parse", "--is-inside-work-tree")
+// IsWorking will check the directory is inside work tree.
+// OpenDir checks it in the same "git rev-parse" as discovering the root not to run git twice,
+// so this is for callers which need only the check.
+func IsWorking(dir string) (bool, error) {
+	output, err := runIn(dir, "rev-parse", "--is-inside-work-tree")
 	if err != nil {
 		return false, err
 	}
-	return bytes.Equal(output, trueBytes), nil
+	return bytes.Equal(bytes.TrimSpace(output), trueBytes), nil
+}
+
+// IsInGitDir will check the directory is inside the git directory (e.g. ".git").
+func IsInGitDir(dir string) (bool, error) {
+	output, err := runIn(dir, "rev-parse", "--is-inside-git-dir")
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(bytes.TrimSpace(output), trueBytes), nil
+}
+
+// GitDir gets the absolute path of the git directory for the directory.
+func GitDir(dir string) (string, error) {
+	return str(runIn(dir, "rev-parse", "--absolute-git-dir"))
+}
+
+// CommonDir gets the absolute path of the git directory shared by the linked worktrees,
+// which has refs, objects and so on. It is the same as GitDir for the main worktree.
+func CommonDir(dir string) (string, error) {
+	commonDir, err := str(runIn(dir, "rev-parse", "--git-common-dir"))
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(dir, commonDir)
+	}
+	return commonDir, nil
+}
+
+// configKeyRegexp limits keys of ConfigValue not to be taken as options or other arguments.
+var configKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ConfigValue gets the value of the config for the directory.
+// It returns empty if the key is not set.
+func ConfigValue(dir, key string) (string, error) {
+	if !configKeyRegexp.MatchString(key) {
+		return "", errors.Errorf("invalid config key %q", key)
+	}
+	return strOrEmpty(runIn(dir, "config", "--get", key))
+}
+
+// HeadBranch gets the current branch name for the directory without the work tree.
+// It returns Head if the HEAD is detached.
+func HeadBranch(dir string) (string, error) {
+	branch, err := strOrEmpty(runIn(dir, "symbolic-ref", "--short", "-q", Head))
+	if err != nil || branch != "" {
+		return branch, err
+	}
+	return Head, nil
+}
+
+// FindRoot will search a root of the work tree from the dir and its parents without calling git.
+func FindRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrIsNotInWorkingDirectory
+		}
+		dir = parent
+	}
+}
+
+// FindGitDir gets the git directory of the work tree root without calling git.
+// If the ".git" is a file (a gitfile in linked worktrees or submodules), it follows the "gitdir: PATH" in it.
+func FindGitDir(root string) (string, error) {
+	gitDir := filepath.Join(root, ".git")
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return gitDir, nil
+	}
+	content, err := ioutil.ReadFile(gitDir)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", errors.Errorf("invalid gitfile %s", gitDir)
+	}
+	path := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	return path, nil
 }
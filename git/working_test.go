@@ -0,0 +1,37 @@
+package git_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/kyoh86/git-prompt/git/testutil"
+)
+
+// TestIsWorking checks directories other than the current one, which is in this repository.
+func TestIsWorking(t *testing.T) {
+	r := testutil.NewRepo(t)
+	defer r.Remove()
+	r.WriteFile("sub/file.txt", "content\n")
+	r.Commit("first")
+
+	for _, dir := range []string{r.Dir, filepath.Join(r.Dir, "sub")} {
+		if working, err := git.IsWorking(dir); err != nil || !working {
+			t.Errorf("expect %s to be in the work tree (%v)", dir, err)
+		}
+	}
+	if working, err := git.IsWorking(filepath.Join(r.Dir, ".git")); err != nil || working {
+		t.Errorf("expect the git directory not to be in the work tree (%v)", err)
+	}
+
+	outside, err := ioutil.TempDir("", "git-prompt-test")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(outside)
+	if working, err := git.IsWorking(outside); err == nil && working {
+		t.Errorf("expect %s not to be in a work tree", outside)
+	}
+}
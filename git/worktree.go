@@ -0,0 +1,74 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitDir gets the absolute path of the git directory of the worktree (e.g. "<root>/.git").
+func (g *Git) GitDir() string {
+	return g.gitDir
+}
+
+// CommonDir gets the git directory shared by the worktrees, which has refs, objects and so on,
+// from the "commondir" file in the git directory of a linked worktree (e.g. ".git/worktrees/foo").
+// It is the same as GitDir in the main worktree.
+func (g *Git) CommonDir() (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(g.gitDir, "commondir"))
+	if os.IsNotExist(err) {
+		return g.gitDir, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	dir := strings.TrimSpace(string(content))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(g.gitDir, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// WorktreeNameVar :
+func (g *Git) WorktreeNameVar(v *string) error {
+	return stringSetter(g.WorktreeName())(v)
+}
+
+// WorktreeName gets the name of the linked worktree (see "git worktree list").
+// It returns empty in the main worktree.
+func (g *Git) WorktreeName() (string, error) {
+	commonDir, err := g.CommonDir()
+	if err != nil || commonDir == g.gitDir {
+		return "", err
+	}
+	return filepath.Base(g.gitDir), nil
+}
+
+// WorktreeCountVar :
+func (g *Git) WorktreeCountVar(v *int) error {
+	return intSetter(g.WorktreeCount())(v)
+}
+
+// WorktreeCount counts the worktrees of the repository including the main one,
+// from the directories in "worktrees" of the common git directory.
+func (g *Git) WorktreeCount() (int, error) {
+	commonDir, err := g.CommonDir()
+	if err != nil {
+		return 0, err
+	}
+	entries, err := ioutil.ReadDir(filepath.Join(commonDir, "worktrees"))
+	if os.IsNotExist(err) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	count := 1
+	for _, entry := range entries {
+		if entry.IsDir() {
+			count++
+		}
+	}
+	return count, nil
+}
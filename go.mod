@@ -1,12 +1,15 @@
 module github.com/kyoh86/git-prompt
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/alecthomas/kingpin v2.2.6+incompatible
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/pkg/errors v0.9.1
 	github.com/wacul/ulog v0.0.0-20190903030145-8950f45918c4
 	golang.org/x/net v0.0.0-20220127200216-cd36cc0744dd // indirect
+	golang.org/x/sys v0.7.0 // indirect
 )
 
 go 1.13
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/wacul/ulog"
 	"github.com/wacul/ulog/adapter/stdlog"
@@ -17,10 +18,15 @@ func Background(verbose []bool) context.Context {
 // Context will get context for ulog.
 func Context(ctx context.Context, verbose []bool) context.Context {
 	var level ulog.Level
-	switch len(verbose) {
+	switch verbosity(verbose) {
 	case 0:
 		level = ulog.WarnLevel
-		log.SetOutput(logger())
+		if w, err := logger(); err == nil {
+			log.SetOutput(w)
+		} else {
+			// fallback if the system logger is not available
+			log.SetOutput(os.Stderr)
+		}
 	case 1:
 		level = ulog.InfoLevel
 		log.SetOutput(os.Stderr)
@@ -31,3 +37,15 @@ func Context(ctx context.Context, verbose []bool) context.Context {
 
 	return ulog.Logger(ctx).WithAdapter(&stdlog.Adapter{Level: level})
 }
+
+// verbosity counts the verbose flags.
+// If no flag is given, it reads GIT_PROMPT_VERBOSE (0, 1 or 2) instead.
+func verbosity(verbose []bool) int {
+	if len(verbose) > 0 {
+		return len(verbose)
+	}
+	if level, err := strconv.Atoi(os.Getenv("GIT_PROMPT_VERBOSE")); err == nil && level > 0 {
+		return level
+	}
+	return 0
+}
@@ -7,10 +7,6 @@ import (
 	"log/syslog"
 )
 
-func logger() io.Writer {
-	l, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, "git-prompt")
-	if err != nil {
-		panic(err)
-	}
-	return l
+func logger() (io.Writer, error) {
+	return syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, "git-prompt")
 }
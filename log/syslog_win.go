@@ -7,6 +7,6 @@ import (
 	"os"
 )
 
-func logger() io.Writer {
-	return os.Stderr
+func logger() (io.Writer, error) {
+	return os.Stderr, nil
 }
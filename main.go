@@ -1,213 +1,457 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"html/template"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin"
 	"github.com/kyoh86/git-prompt/git"
 	"github.com/kyoh86/git-prompt/log"
+	"github.com/kyoh86/git-prompt/prompt"
+	"github.com/kyoh86/git-prompt/version"
 	"github.com/wacul/ulog"
 )
 
-// nolint
-var (
-	version = "snapshot"
-	commit  = "snapshot"
-	date    = "snapshot"
+// Exit codes of the git-prompt other than 0 for success.
+// Invalid arguments are also exited with exitFailure by kingpin.
+const (
+	exitFailure         = 1
+	exitNotInRepository = 3 // the directory is not in a repository, or the repository is skipped
 )
 
 func assertError(ctx context.Context, err error, doing string) {
 	if err != nil {
 		logger := ulog.Logger(ctx)
 		logger.WithField("error", err).Error("failed to " + doing)
-		panic(err)
+		os.Exit(exitFailure)
 	}
 }
 
-// Stat holds git statuses
-type Stat struct {
-	Root        string
-	Name        string
-	Subdir      string
-	Branch      string
-	Hash        string
-	Staged      bool
-	Unstaged    bool
-	Untracked   bool
-	Email       string
-	StashCount  int
-	LastEmail   string
-	LastMessage string
-	Wip         bool
-	Upstream    string
-	Behind      int
-	Ahead       int
-	BaseBranch  string
-	BaseBehind  int
+// schemaVersion is output as "schema_version" with the stat by the "json" style.
+const schemaVersion = 1
+
+// jsonStat is output by the "json" style.
+type jsonStat struct {
+	SchemaVersion int `json:"schema_version"`
+	prompt.Stat
+}
+
+// options are given from the command line.
+type options struct {
+	Dir               string
+	Style             string
+	StyleSet          bool
+	Escape            string
+	Colorizer         string
+	ListStyles        bool
+	Theme             string
+	GitPath           string
+	GitDir            string
+	WorkTree          string
+	CacheDir          string
+	CacheTTL          time.Duration
+	Timeout           time.Duration
+	Collect           prompt.Options
+	Timing            bool
+	Output            string
+	Skip              []string
+	WipPattern        string
+	Symbols           map[string]string
+	Fields            string
+	SubdirShortLength int
+	UntrackedAsDirty  bool
+	Null              bool
+	Watch             bool
+	WatchDelay        time.Duration
+	Verbose           []bool
+	Socket            string
+	Query             bool
 }
 
 func main() {
-	styles := map[string]string{
-		"zsh": `%F{yellow}
-			{{- if eq .Staged true -}}    + {{- end -}}
-			{{- if eq .Unstaged true -}}  - {{- end -}}
-			{{- if eq .Untracked true -}} ? {{- end -}}
-			%f
-			{{- if and .Wip (eq .Email .LastEmail) -}}
-				%F{red}!wip!%f
-			{{- end -}}
-			{{- if gt .Ahead 0 -}}  %F{red}⬆ {{.Ahead}}%f      {{- end -}}
-			{{- if gt .Behind 0 -}} %F{magenta}⬇ {{.Behind}}%f {{- end -}}
-			{{- if gt .BaseBehind 0 -}}
-				%F{yellow}({{.BaseBranch}}%f%F{red}-{{.BaseBehind}}%f%F{yellow})%f
-			{{- end -}}
-			{{- if gt .StashCount 0 -}}
-				%F{yellow}♻ {{.StashCount}}%f
-			{{- end}} %F{blue}[{{.Name}}%f
-			{{- if ne .Subdir "."}}
-				%F{yellow}/{{.Subdir}}%f
-			{{- end -}}
-			{{- if and (ne .Branch "main") (ne .Branch "") -}}
-				%F{green}:{{.Branch}}%f
-			{{- end -}}
-			{{- if eq .Upstream "" -}}
-				%F{red}⚑%f
-			{{- end -}}
-			%F{blue}]%f`,
-
-		"tmux": `#[bg=black]#[fg=yellow]
-			{{- if eq .Staged true -}}    + {{- end -}}
-			{{- if eq .Unstaged true -}}  - {{- end -}}
-			{{- if eq .Untracked true -}} ? {{- end -}}
-			{{- if and .Wip (eq .Email .LastEmail) -}}
-			#[fg=red]!wip!
-			{{- end -}}
-			{{- if gt .Ahead 0 -}}  #[fg=red]⬆ {{.Ahead}}      {{- end -}}
-			{{- if gt .Behind 0 -}} #[fg=magenta]⬇ {{.Behind}} {{- end -}}
-			{{- if gt .BaseBehind 0 -}}
-			#[fg=yellow]({{.BaseBranch}}#[fg=red]-{{.BaseBehind}}#[fg=yellow])
-			{{- end -}}
-			{{- if gt .StashCount 0 -}}
-			#[fg=yellow]♻ {{.StashCount}}
-			{{- end}} #[fg=blue][{{.Name}}
-			{{- if ne .Subdir "." -}}
-			#[fg=yellow]/{{.Subdir}}
-			{{- end -}}
-			{{- if and (ne .Branch "main") (ne .Branch "") -}}
-			#[fg=green]:{{.Branch}}
-			{{- end -}}
-			{{- if eq .Upstream "" -}}#[fg=red]⚑{{end -}}
-			#[fg=blue]]#[fg=default]#[fg=black,bg=colour8]` + "\ue0b0",
-	}
-
-	app := kingpin.New("git-prompt", "Show prompt strings for tmux, vim and zsh").Version(version).Author("kyoh86")
-	var option struct {
-		Dir     string
-		Style   string
-		Verbose []bool
-	}
-	app.Flag("style", "output style").Short('s').Default("pretty").StringVar(&option.Style)
-	app.Flag("verbose", "log verbose").Short('v').BoolListVar(&option.Verbose)
-
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	app := kingpin.New("git-prompt", "Show prompt strings for tmux, vim and zsh").Version(version.String()).Author("kyoh86")
+	var option options
+
+	cfg, err := loadConfig()
+	app.FatalIfError(err, "")
+	option.Skip = cfg.Skip
+	option.Symbols = cfg.Symbols
+	option.Collect.Forges = cfg.Forges
+	option.Collect.DefaultBaseBranch = cfg.BaseBranch
+	option.Collect.StatusExcludes = cfg.StatusExcludes
+	app.FatalIfError(registerStyles(cfg.Styles), "invalid styles in the config file")
+
+	app.Flag("dir", "directory to show the prompt for").Short('C').Envar("GIT_PROMPT_DIR").StringVar(&option.Dir)
+	app.Flag("style", "output style (default can be set by GIT_PROMPT_STYLE, or GIT_PROMPT_FORMAT as a format)").Short('s').Default(orDefault(cfg.Style, "pretty")).Action(func(*kingpin.ParseContext) error {
+		option.StyleSet = true
+		return nil
+	}).StringVar(&option.Style)
+	app.Flag("escape", "escape values in the style: html for status bars which render HTML, bash for PS1 (auto: bash for the bash style)").Default("auto").EnumVar(&option.Escape, escapes...)
+	app.Flag("colorizer", "built-in style (e.g. zsh, tmux or ansi) to color with in the \"color\" function (default: the --style; none for format:, f: and file:)").Envar("GIT_PROMPT_COLORIZER").StringVar(&option.Colorizer)
+	app.Flag("list-styles", "list available styles and exit").BoolVar(&option.ListStyles)
+	app.Flag("theme", "color theme of the styles").Default(orDefault(cfg.Theme, "dark")).EnumVar(&option.Theme, themeNames()...)
+	app.Flag("git-dir", "git directory of the repository (as GIT_DIR)").StringVar(&option.GitDir)
+	app.Flag("work-tree", "work tree of the repository (as GIT_WORK_TREE)").StringVar(&option.WorkTree)
+	app.Flag("git-path", "path of the git executable").Envar("GIT_PROMPT_GIT").Default("git").StringVar(&option.GitPath)
+	app.Flag("cache-dir", "directory to cache statuses in").StringVar(&option.CacheDir)
+	app.Flag("cache-ttl", "time to live of the cached statuses").Default("5s").DurationVar(&option.CacheTTL)
+	app.Flag("stash", "count stashes (--no-stash to skip)").Default("true").BoolVar(&option.Collect.Stash)
+	app.Flag("ahead-behind", "count ahead and behind commits (--no-ahead-behind to skip)").Default("true").BoolVar(&option.Collect.AheadBehind)
+	app.Flag("base", "search base branch (--no-base to skip)").Default("true").BoolVar(&option.Collect.Base)
+	app.Flag("merge-base", "count commits since the merge-base with the base branch as MergeBaseAhead/MergeBaseBehind").BoolVar(&option.Collect.MergeBase)
+	app.Flag("compare-ref", "ref (e.g. a tag or a branch) to count ahead/behind as CompareAhead/CompareBehind").StringVar(&option.Collect.CompareRef)
+	app.Flag("base-branch", "base branch to compare with (default: branch.<name>.gitprompt-base, gitprompt.baseBranch in the repository, base_branch in the config file, the default branch of the remote or guessed from the branch name)").StringVar(&option.Collect.BaseBranch)
+	app.Flag("guess-base-first", "guess the base branch from the branch name (e.g. origin/feature for feature/foo) before the default branch of the remote").BoolVar(&option.Collect.GuessBaseFirst)
+	app.Flag("name-remote", "remote to name the repository from its URL (default: the remote of the branch, or origin)").StringVar(&option.Collect.NameRemote)
+	app.Flag("wip-pattern", "pattern of the last commit message to show it is WIP").Default(orDefault(cfg.WipPattern, `^wip(\W|$)`)).StringVar(&option.WipPattern)
+	app.Flag("diff-stat", "count inserted and deleted lines (--no-diff-stat to skip)").Default("true").BoolVar(&option.Collect.DiffStat)
+	app.Flag("subdir-short-length", "length of each directory in SubdirShort").Default("1").IntVar(&option.SubdirShortLength)
+	app.Flag("timeout", "give up git commands running longer than this in total, and show statuses collected until then (e.g. 200ms; 0 to wait)").Default(orDefault(cfg.Timeout, "0")).DurationVar(&option.Timeout)
+	app.Flag("minimal-if-slow", "show only the branch if reading it takes longer than this (e.g. 200ms; 0 to disable)").Default("0").DurationVar(&option.Collect.MinimalIfSlow)
+	app.Flag("untracked", "how to count untracked files in statuses like git status --untracked-files (no, normal or all)").Default("normal").EnumVar(&option.Collect.UntrackedMode, "no", "normal", "all")
+	app.Flag("untracked-as-dirty", "deprecated: --no-untracked-as-dirty is --untracked=no").Hidden().Default("true").BoolVar(&option.UntrackedAsDirty)
+	app.Flag("status-exclude", "pathspec of files not to count in statuses (e.g. 'vendor/*'; repeatable)").StringsVar(&option.Collect.StatusExcludes)
+	app.Flag("ignore-submodules", "changes of submodules to ignore in statuses and DirtySubmodules (default: the config of git)").EnumVar(&option.Collect.IgnoreSubmodules, "none", "untracked", "dirty", "all")
+	app.Flag("raw", "set the output of git status --porcelain to Raw").BoolVar(&option.Collect.Raw)
+	app.Flag("hash-length", "length of the abbreviated commit hash").Default("6").IntVar(&option.Collect.HashLength)
+	app.Flag("fields", "print only the fields separated by comma (e.g. branch,ahead,behind) one per line").StringVar(&option.Fields)
+	app.Flag("null", "terminate each of the --fields with NUL instead of newline").Short('0').BoolVar(&option.Null)
+	app.Flag("output", "file to write the output to (- for stdout)").Short('o').Default("-").StringVar(&option.Output)
+	app.Flag("watch", "keep running and print the prompt whenever the repository changes").BoolVar(&option.Watch)
+	app.Flag("watch-delay", "delay to wait for changes to settle in the watch mode").Default("100ms").DurationVar(&option.WatchDelay)
+	app.Flag("jobs", "number of git commands to run at once (1 to run them in order)").Short('j').Default("8").IntVar(&option.Collect.Jobs)
+	app.Flag("timing", "print durations of each git invocation to stderr").BoolVar(&option.Timing)
+	app.Flag("verbose", "log verbose (or set GIT_PROMPT_VERBOSE=1 or 2)").Short('v').BoolListVar(&option.Verbose)
+
+	app.Flag("socket", "unix socket of the daemon (default: git-prompt.sock in $XDG_RUNTIME_DIR, or git-prompt-<uid>/daemon.sock in the temporary directory)").Envar("GIT_PROMPT_SOCKET").StringVar(&option.Socket)
+	app.Command("render", "show the prompt").Default()
+	daemonCmd := app.Command("daemon", "keep statuses of repositories in memory, and answer them to the query over the unix socket")
+	queryCmd := app.Command("query", "show the prompt with statuses from the daemon, or collected locally if it is not running")
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+	if option.Socket == "" {
+		option.Socket = defaultSocket()
+	}
+	option.Query = command == queryCmd.FullCommand()
 
 	ctx := log.Background(option.Verbose)
 
+	{
+		wip, err := regexp.Compile(option.WipPattern)
+		app.FatalIfError(err, "invalid --wip-pattern")
+		option.Collect.Wip = wip
+	}
+	if option.Collect.HashLength < 1 {
+		app.Fatalf("--hash-length must be 1 or more")
+	}
+	if option.SubdirShortLength < 1 {
+		app.Fatalf("--subdir-short-length must be 1 or more")
+	}
+	if !option.UntrackedAsDirty {
+		option.Collect.UntrackedMode = "no"
+	}
+
+	if option.ListStyles {
+		for _, name := range styleNames() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	git.Path = option.GitPath
+	if command == daemonCmd.FullCommand() {
+		app.FatalIfError(serveDaemon(ctx, option.Socket, &option), "serve the daemon")
+		return
+	}
+	if option.Timing {
+		git.RecordTiming = true
+		defer printTimings()
+	}
+
 	if option.Dir == "" {
 		wd, err := os.Getwd()
 		assertError(ctx, err, "get working directory")
 		option.Dir = wd
+	} else {
+		dir, err := filepath.Abs(option.Dir)
+		assertError(ctx, err, "get absolute path of the directory")
+		option.Dir = dir
+	}
+
+	assertError(ctx, setGitEnv("GIT_DIR", option.GitDir, option.Dir), "set GIT_DIR")
+	assertError(ctx, setGitEnv("GIT_WORK_TREE", option.WorkTree, option.Dir), "set GIT_WORK_TREE")
+	if (option.CacheDir != "" || option.Query) && (os.Getenv("GIT_DIR") != "" || os.Getenv("GIT_WORK_TREE") != "") {
+		// the cache and the daemon find the repository from the directory without git, which does not know them
+		ulog.Logger(ctx).Debug("disable the cache and the daemon for GIT_DIR or GIT_WORK_TREE")
+		option.CacheDir = ""
+		option.Query = false
+	}
+
+	if !option.StyleSet {
+		if envStyle, ok := os.LookupEnv("GIT_PROMPT_STYLE"); ok {
+			option.Style = envStyle
+		} else if envFormat, ok := os.LookupEnv("GIT_PROMPT_FORMAT"); ok {
+			option.Style = "format:" + envFormat
+		}
 	}
 
 	var format string
-	var pretty bool
+	var pretty, machine bool
 	switch {
 	case strings.HasPrefix(option.Style, "format:"):
 		format = strings.TrimPrefix(option.Style, "format:")
 	case strings.HasPrefix(option.Style, "f:"):
 		format = strings.TrimPrefix(option.Style, "f:")
+	case strings.HasPrefix(option.Style, "file:"):
+		content, err := ioutil.ReadFile(expandHome(strings.TrimPrefix(option.Style, "file:")))
+		app.FatalIfError(err, "read the style file")
+		// an editor ends the file with a newline, which should not be in the prompt
+		format = strings.TrimRight(string(content), "\r\n")
 	case option.Style == "pretty":
 		format = ""
 		pretty = true
+	case option.Style == "json":
+		format = ""
+		machine = true
 	default:
-		format = styles[option.Style]
+		style, ok := styles[option.Style]
+		if !ok {
+			app.Fatalf("unknown style %q (available: %s)", option.Style, strings.Join(styleNames(), ", "))
+		}
+		format = style
 	}
 
-	tmp, tmpErr := template.New("stat").Parse(format)
+	colorizer, err := resolveColorizer(option.Style, option.Colorizer)
+	app.FatalIfError(err, "")
+	if option.Escape == "auto" {
+		option.Escape = "none"
+		if escape, ok := styleEscapes[colorizer]; ok {
+			option.Escape = escape
+		}
+	}
+
+	// root of the repository which the "config" function reads for the current stat
+	var root string
+	config := func(key string) (string, error) {
+		value, err := git.ConfigValue(root, key)
+		if option.Escape == "bash" {
+			value = escapeBash(value)
+		}
+		return value, err
+	}
+	tmp, tmpErr := parseStyle(format, option.Escape, templateFuncs(colorizer, mergeColors(themes[option.Theme], cfg.Colors), option.Symbols, config, option.Escape == "html"))
 	assertError(ctx, tmpErr, "parse format template")
 
-	var stat Stat
+	// collect only the fields to show: pretty and json show all of them,
+	// and the cache is shared by all the templates
+	switch {
+	case option.CacheDir != "":
+	case option.Fields != "":
+		option.Collect.Fields = prompt.FieldSet(strings.Split(option.Fields, ","))
+	case !pretty && !machine:
+		option.Collect.Fields = usedFields(tmp.trees...)
+	}
 
-	repo, repoErr := git.OpenDir(option.Dir)
-	if repoErr == git.ErrIsNotInWorkingDirectory {
+	var found bool
+	output := func() {
+		stat, ok := loadStat(ctx, &option)
+		found = ok
+		if !ok {
+			return
+		}
+		root = stat.Root
+		var buf bytes.Buffer
+		if option.Fields != "" {
+			terminator := "\n"
+			if option.Null {
+				terminator = "\x00"
+			}
+			fields, err := formatFields(stat, strings.Split(option.Fields, ","), terminator)
+			assertError(ctx, err, "format fields")
+			assertError(ctx, writeOutput(option.Output, []byte(fields)), "write output")
+			return
+		}
+		if pretty {
+			dump, err := dumpFields(stat)
+			assertError(ctx, err, "output pretty")
+			buf.Write(dump)
+		}
+		if machine {
+			assertError(ctx, json.NewEncoder(&buf).Encode(jsonStat{SchemaVersion: schemaVersion, Stat: stat}), "output json")
+		}
+
+		data := stat
+		if option.Escape == "bash" {
+			// values are expanded by bash in PS1: see escapeBash
+			data = escapeFields(stat, escapeBash)
+		}
+		assertError(ctx, tmp.execute(&buf, data), "output stats")
+		if option.Watch {
+			buf.WriteString("\n")
+		}
+		assertError(ctx, writeOutput(option.Output, buf.Bytes()), "write output")
+	}
+
+	if option.Watch {
+		// the same repository as loadStat opens, following GIT_DIR and GIT_WORK_TREE
+		repo, err := git.OpenDirContext(ctx, option.Dir)
+		assertError(ctx, err, "open a repository")
+		defer repo.Close()
+		assertError(ctx, watch(ctx, repo, option.WatchDelay, output), "watch the repository")
 		return
 	}
-	assertError(ctx, repoErr, "open a repository")
-	defer repo.Close()
-	stat.Root = repo.Root()
-	stat.Name = filepath.Base(stat.Root)
+	output()
+	if !found {
+		if option.Timing {
+			printTimings() // os.Exit skips the deferred one
+		}
+		os.Exit(exitNotInRepository)
+	}
+}
+
+// loadStat gets statuses from the cache or the repository.
+// It returns false if the directory is not in a repository to show.
+func loadStat(ctx context.Context, option *options) (stat prompt.Stat, ok bool) {
+	var cached bool
+	if option.Query {
+		queryCtx := ctx
+		if option.Timeout > 0 {
+			var cancel context.CancelFunc
+			queryCtx, cancel = context.WithTimeout(ctx, option.Timeout)
+			defer cancel()
+		}
+		stat, cached = queryDaemon(queryCtx, option.Socket, option.Dir, option.Collect)
+	}
+	if !cached && option.CacheDir != "" {
+		stat, cached = loadCache(ctx, option.CacheDir, option.Dir, option.Collect, option.CacheTTL)
+	}
+	skips := append(filepath.SplitList(os.Getenv("GIT_PROMPT_SKIP")), option.Skip...)
+	if cached && skipped(stat.Root, skips) {
+		return stat, false
+	}
+	if !cached {
+		// the timeout covers the discovery of the repository too
+		collectCtx := ctx
+		if option.Timeout > 0 {
+			var cancel context.CancelFunc
+			collectCtx, cancel = context.WithTimeout(ctx, option.Timeout)
+			defer cancel()
+		}
+		repo, repoErr := git.OpenDirContext(collectCtx, option.Dir)
+		if repoErr == git.ErrIsNotInWorkingDirectory {
+			inGitDir, err := prompt.CollectInGitDir(option.Dir)
+			if err == prompt.ErrNotInRepository {
+				return stat, false
+			}
+			assertError(ctx, err, "collect statuses in the git directory")
+			stat = *inGitDir
+		} else {
+			assertError(ctx, repoErr, "open a repository")
+			defer repo.Close()
+			if skipped(repo.Root(), skips) {
+				return stat, false
+			}
+			stat = *prompt.CollectRepo(collectCtx, repo, option.Collect)
+			if option.CacheDir != "" && !stat.Degraded && stat.Errors == nil {
+				storeCache(ctx, option.CacheDir, option.Collect, stat)
+			}
+		}
+	}
 
 	{
 		subdir, err := filepath.Rel(stat.Root, option.Dir)
 		assertError(ctx, err, "get rel path from root")
+		if subdir == ".." || strings.HasPrefix(subdir, "../") {
+			// out of the work tree given by GIT_WORK_TREE
+			subdir = "."
+		}
 		stat.Subdir = subdir
+		stat.SubdirShort = shortenPath(subdir, option.SubdirShortLength)
+		stat.SubdirDepth = pathDepth(subdir)
 	}
+	return stat, true
+}
 
-	assertError(ctx, repo.StagedVar(&stat.Staged), "get staged")
-	assertError(ctx, repo.UnstagedVar(&stat.Unstaged), "get unstaged")
-	assertError(ctx, repo.UntrackedVar(&stat.Untracked), "get untracked")
-	assertError(ctx, repo.EmailVar(&stat.Email), "get user account")
-	assertError(ctx, repo.StashCountVar(&stat.StashCount), "open stash log")
-	assertError(ctx, repo.LastCommitHashVar(&stat.Hash), "get last commit hash")
-	assertError(ctx, repo.UpstreamVar(&stat.Upstream), "search upstream")
-	assertError(ctx, repo.AheadCountVar(&stat.Ahead), "count ahead")
-	assertError(ctx, repo.BehindCountVar(&stat.Behind), "count behind")
-	assertError(ctx, repo.BranchVar(&stat.Branch), "get current branch")
-	assertError(ctx, repo.LastCommitterVar(&stat.LastEmail), "get last committer")
-	assertError(ctx, repo.LastCommitMessageVar(&stat.LastMessage), "get last commit message")
-	wipRegexp := regexp.MustCompile(`^wip(\W|$)`)
-	if wipRegexp.MatchString(stat.LastMessage) {
-		stat.Wip = true
+// shortenPath abbreviates each directory in the path to the length, keeping the last one
+// (e.g. "src/github.com/kyoh86" to "s/g/kyoh86").
+func shortenPath(path string, length int) string {
+	dirs := strings.Split(filepath.ToSlash(path), "/")
+	for i, dir := range dirs[:len(dirs)-1] {
+		if runes := []rune(dir); len(runes) > length {
+			dirs[i] = string(runes[:length])
+		}
 	}
+	return filepath.FromSlash(strings.Join(dirs, "/"))
+}
 
-	if stat.Branch == "HEAD" {
-		stat.Branch = string(([]rune(stat.Hash))[:6]) + "..."
+// pathDepth counts directories in the relative path. "." is 0.
+func pathDepth(path string) int {
+	if path == "." {
+		return 0
 	}
-	{
-		remote, err := repo.Remote(stat.Branch)
-		assertError(ctx, err, "search remote")
+	return len(strings.Split(filepath.ToSlash(path), "/"))
+}
 
-		remoteURL, err := repo.RemoteURL(remote)
-		assertError(ctx, err, "search remoteURL")
-		if strings.HasPrefix(remoteURL, "https://github.com/") {
-			stat.Name = strings.TrimSuffix(strings.TrimPrefix(remoteURL, "https://github.com/"), ".git")
+// printTimings prints durations of each git invocation to stderr.
+func printTimings() {
+	var total time.Duration
+	for _, timing := range git.Timings() {
+		total += timing.Duration
+		fmt.Fprintf(os.Stderr, "%12s git %s\n", timing.Duration, strings.Join(timing.Args, " "))
+	}
+	fmt.Fprintf(os.Stderr, "%12s total\n", total)
+}
+
+// setGitEnv sets the environment variable (e.g. GIT_DIR) for git with the flag, or makes
+// the one set by the user absolute: git runs in the root of the work tree, not in the
+// current directory. A relative flag is from the dir like "git -C <dir> --git-dir <flag>".
+func setGitEnv(name, flag, dir string) error {
+	value := flag
+	if value == "" {
+		value = os.Getenv(name)
+		if value == "" {
+			return nil
+		}
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
 		}
+		dir = wd
 	}
-	{
-		baseBranch, err := repo.BaseBranch(stat.Branch)
-		assertError(ctx, err, "search base branch")
-		stat.BaseBranch = baseBranch
+	if !filepath.IsAbs(value) {
+		value = filepath.Join(dir, value)
 	}
+	return os.Setenv(name, value)
+}
 
-	if stat.Upstream != stat.BaseBranch {
-		baseBehinds, err := repo.BehindCountFrom(stat.BaseBranch)
-		assertError(ctx, err, "traverse behind objects from base branch")
-		stat.BaseBehind = baseBehinds
+// expandHome replaces "~" at the head of the path with the home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
 	}
-
-	// TODO: # (%a) action
-
-	if pretty {
-		writer := json.NewEncoder(os.Stdout)
-		writer.SetIndent("", "  ")
-		assertError(ctx, writer.Encode(stat), "output pretty")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
 	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
 
-	assertError(ctx, tmp.Execute(os.Stdout, stat), "output stats")
+// skipped checks the root of the repository matches any of the patterns.
+func skipped(root string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if matched, _ := filepath.Match(filepath.Clean(pattern), root); matched {
+			return true
+		}
+	}
+	return false
 }
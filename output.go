@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeOutput writes the data to the file at the path, or stdout if the path is "-".
+// The file is replaced atomically to be read by another process safely, keeping its mode
+// (0644 for a new file).
+func writeOutput(path string, data []byte) (reterr error) {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if reterr != nil {
+			os.Remove(tmpFile.Name())
+		}
+	}()
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	// the temporary file is made with 0600
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmpFile.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestWriteOutputMode checks the replaced file keeps its mode, and a new file is made with 0644.
+func TestWriteOutputMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes of files are not supported")
+	}
+	dir, err := ioutil.TempDir("", "git-prompt-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, c := range []struct {
+		name   string
+		mode   os.FileMode // 0 for a new file
+		expect os.FileMode
+	}{
+		{name: "new", expect: 0644},
+		{name: "existing", mode: 0640, expect: 0640},
+	} {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, c.name)
+			if c.mode != 0 {
+				if err := ioutil.WriteFile(path, []byte("old"), c.mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(path, c.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writeOutput(path, []byte("new")); err != nil {
+				t.Fatalf("failed to write the output: %s", err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode := info.Mode().Perm(); mode != c.expect {
+				t.Errorf("expect the mode %o but got %o", c.expect, mode)
+			}
+			if content, _ := ioutil.ReadFile(path); string(content) != "new" {
+				t.Errorf("expect the content %q but got %q", "new", content)
+			}
+		})
+	}
+}
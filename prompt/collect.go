@@ -0,0 +1,470 @@
+package prompt
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/pkg/errors"
+	"github.com/wacul/ulog"
+)
+
+// ErrNotInRepository is returned if the directory is neither in a work tree nor in a git directory.
+var ErrNotInRepository = errors.New("not in a repository")
+
+// Collect collects statuses of the repository containing the dir.
+// Git commands are given up when the ctx is done, and the stat is marked as Degraded then.
+// It returns ErrNotInRepository if the dir is not in a repository.
+func Collect(ctx context.Context, dir string, opt Options) (*Stat, error) {
+	repo, err := git.OpenDirContext(ctx, dir)
+	if err == git.ErrIsNotInWorkingDirectory {
+		return CollectInGitDir(dir)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "open a repository")
+	}
+	defer repo.Close()
+	return CollectRepo(ctx, repo, opt), nil
+}
+
+// CollectInGitDir collects minimal statuses if the dir is inside a git directory (e.g. ".git").
+// It returns ErrNotInRepository if the dir is not in a repository.
+func CollectInGitDir(dir string) (*Stat, error) {
+	if inGitDir, _ := git.IsInGitDir(dir); !inGitDir {
+		return nil, ErrNotInRepository
+	}
+	stat := &Stat{InGitDir: true}
+
+	gitDir, err := git.GitDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "get git directory")
+	}
+	stat.Root = gitDir
+	if filepath.Base(gitDir) == ".git" {
+		stat.Name = filepath.Base(filepath.Dir(gitDir))
+	} else {
+		stat.Name = strings.TrimSuffix(filepath.Base(gitDir), ".git")
+	}
+
+	branch, err := git.HeadBranch(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "get current branch")
+	}
+	stat.Branch = branch
+	stat.Detached = branch == git.Head
+	return stat, nil
+}
+
+// Options switch expensive checks in collecting statuses.
+// They are given by the flags of git-prompt with the same names.
+type Options struct {
+	Stash            bool
+	AheadBehind      bool
+	Base             bool
+	MergeBase        bool
+	DiffStat         bool
+	Raw              bool
+	UntrackedMode    string // "no", "normal", "all" or empty for the mode of the repository (see git.WithUntrackedMode)
+	StatusExcludes   []string
+	IgnoreSubmodules string // "none", "untracked", "dirty", "all" or empty for the config of git
+	HashLength       int
+	Jobs             int // git commands to run at once
+	MinimalIfSlow    time.Duration
+	BaseBranch       string
+	// GuessBaseFirst guesses the base branch from the branch name (git.GuessBaseBranch)
+	// before the default branch of the remote.
+	GuessBaseFirst bool
+	// DefaultBaseBranch is used if no base branch is configured in the repository (e.g. from the config file).
+	DefaultBaseBranch string
+	CompareRef        string
+	NameRemote        string
+	Forges            map[string]string // labels of forges by host patterns, before the known ones
+	Wip               *regexp.Regexp    `json:"-"` // pattern of the last commit message to set Wip (nil to skip)
+	// Fields are keys of the fields to collect made by FieldSet. Nil collects all of them.
+	Fields map[string]bool
+}
+
+// needs checks any of the fields (e.g. "StashCount") are used.
+// A nil Fields of the option uses all of them.
+func (o Options) needs(names ...string) bool {
+	if o.Fields == nil {
+		return true
+	}
+	for _, name := range names {
+		if o.Fields[FieldKey(name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectRepo collects statuses from the opened repository.
+// A failure in a part of them is recorded in the Errors of the stat, and others are collected.
+// Git commands are run with the ctx: they are given up when it is done.
+func CollectRepo(ctx context.Context, repo *git.Git, opt Options) *Stat {
+	stat := collect(ctx, repo, opt)
+	return &stat
+}
+
+func collect(ctx context.Context, repo *git.Git, opt Options) (stat Stat) {
+	errs := &collectErrors{ctx: ctx}
+	defer func() {
+		stat.Errors = errs.errors
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// some of the statuses may be empty for the --timeout
+			stat.Degraded = true
+		}
+	}()
+	stat.Root = repo.Root()
+	stat.Name = filepath.Base(stat.Root)
+	stat.StatusExcludes = opt.StatusExcludes
+	repo.SetStatusFilter(git.StatusFilter{
+		UntrackedMode:    opt.UntrackedMode,
+		IgnoreSubmodules: opt.IgnoreSubmodules,
+		Excludes:         opt.StatusExcludes,
+	})
+	stat.UntrackedMode = repo.UntrackedMode()
+	if opt.Raw {
+		errs.check(repo.PorcelainVar(ctx, &stat.Raw), "get raw status")
+	}
+
+	if opt.MinimalIfSlow > 0 {
+		start := time.Now()
+		errs.check(repo.BranchFastVar(ctx, &stat.Branch), "read current branch")
+		if time.Since(start) > opt.MinimalIfSlow {
+			// the repository seems to be on a slow filesystem (e.g. a network mount)
+			ulog.Logger(ctx).WithField("threshold", opt.MinimalIfSlow).Info("skip collecting statuses")
+			stat.Degraded = true
+			stat.Detached = stat.Branch == git.Head
+			return stat
+		}
+	}
+
+	// independent git commands run at once, and each of them sets its own fields of the stat
+	jobs := newParallel(opt.Jobs)
+	jobs.Go(func() {
+		// all of them are read from a single "git status"
+		errs.check(repo.StagedVar(ctx, &stat.Staged), "get staged")
+		errs.check(repo.UnstagedVar(ctx, &stat.Unstaged), "get unstaged")
+		errs.check(repo.UntrackedVar(ctx, &stat.Untracked), "get untracked")
+		errs.check(repo.ConflictedVar(ctx, &stat.Conflicted), "get conflicted")
+		errs.check(repo.StagedCountVar(ctx, &stat.StagedCount), "count staged")
+		errs.check(repo.UnstagedCountVar(ctx, &stat.UnstagedCount), "count unstaged")
+		errs.check(repo.UntrackedCountVar(ctx, &stat.UntrackedCount), "count untracked")
+		errs.check(repo.DirtySubmoduleCountVar(ctx, &stat.DirtySubmodules), "count dirty submodules")
+		if err := repo.HasCommitsVar(ctx, &stat.HasCommits); err != nil {
+			errs.check(err, "check commits")
+		} else {
+			// the branch of a new repository or an orphan branch has nothing to compare with upstreams
+			stat.Unborn = !stat.HasCommits
+		}
+		errs.check(repo.BranchVar(ctx, &stat.Branch), "get current branch")
+		errs.check(repo.UpstreamVar(ctx, &stat.Upstream), "search upstream")
+		errs.check(repo.UpstreamGoneVar(ctx, &stat.UpstreamGone), "check upstream gone")
+		if opt.AheadBehind {
+			errs.check(repo.AheadCountVar(ctx, &stat.Ahead), "count ahead")
+			errs.check(repo.BehindCountVar(ctx, &stat.Behind), "count behind")
+		}
+		errs.check(repo.ConflictCountVar(ctx, &stat.ConflictCount), "count conflicts")
+	})
+	if opt.DiffStat && opt.needs("Insertions", "Deletions") {
+		jobs.Go(func() {
+			var err error
+			stat.Insertions, stat.Deletions, err = repo.DiffStat(ctx)
+			errs.check(err, "get diff stat")
+		})
+	}
+	if opt.DiffStat && opt.needs("StagedInsertions", "StagedDeletions") {
+		jobs.Go(func() {
+			var err error
+			stat.StagedInsertions, stat.StagedDeletions, err = repo.StagedDiffStat(ctx)
+			errs.check(err, "get staged diff stat")
+		})
+	}
+	if opt.needs("SubmoduleCount", "SubmoduleOutOfSync") {
+		jobs.Go(func() {
+			var err error
+			stat.SubmoduleCount, stat.SubmoduleOutOfSync, err = repo.SubmoduleStatus(ctx)
+			errs.check(err, "get submodule status")
+		})
+	}
+	if opt.needs("WorktreeName", "WorktreeCount") {
+		jobs.Go(func() {
+			errs.check(repo.WorktreeNameVar(&stat.WorktreeName), "get worktree name")
+			errs.check(repo.WorktreeCountVar(&stat.WorktreeCount), "count worktrees")
+		})
+	}
+	if opt.needs("LFSPending") {
+		jobs.Go(func() {
+			if err := repo.LFSStatusVar(ctx, &stat.LFSPending); err == git.ErrNoLFS {
+				ulog.Logger(ctx).WithField("error", err).Debug("skip LFS status")
+			} else {
+				errs.check(err, "get LFS status")
+			}
+		})
+	}
+	if opt.needs("Shallow") {
+		jobs.Go(func() {
+			errs.check(repo.IsShallowVar(ctx, &stat.Shallow), "check shallow clone")
+		})
+	}
+	if opt.needs("Partial") {
+		jobs.Go(func() {
+			errs.check(repo.IsPartialVar(ctx, &stat.Partial), "check partial clone")
+		})
+	}
+	if opt.needs("Email", "LocalEmailSet") {
+		jobs.Go(func() {
+			errs.check(repo.EmailVar(ctx, &stat.Email), "get user account")
+			localEmail, err := repo.LocalEmail(ctx)
+			errs.check(err, "get local user account")
+			stat.LocalEmailSet = localEmail != ""
+		})
+	}
+	if opt.Stash && opt.needs("StashCount") {
+		jobs.Go(func() {
+			errs.check(repo.StashCountVar(ctx, &stat.StashCount), "open stash log")
+		})
+	}
+	if opt.Stash && opt.needs("StashLatestMessage", "StashLatestAge") {
+		jobs.Go(func() {
+			var err error
+			stat.StashLatestMessage, stat.StashLatestAge, err = repo.LatestStash(ctx)
+			errs.check(err, "get latest stash")
+		})
+	}
+	if opt.needs("Remotes", "Forge", "Name") {
+		jobs.Go(func() {
+			errs.check(repo.RemotesVar(ctx, &stat.Remotes), "list remotes")
+		})
+	}
+	if opt.needs("Action", "ActionStep", "ActionTotal", "ActionDetail", "Operation") {
+		jobs.Go(func() {
+			var err error
+			stat.Action, stat.ActionStep, stat.ActionTotal, err = repo.Action()
+			errs.check(err, "detect action")
+			errs.check(repo.OperationVar(&stat.Operation), "detect operation")
+		})
+	}
+	jobs.Wait()
+	stat.SubmoduleDirty = stat.DirtySubmodules > 0
+
+	if stat.Unborn {
+		stat.Upstream = ""
+		stat.UpstreamGone = false
+		stat.Ahead, stat.Behind = 0, 0
+	}
+
+	// commands which need the branch (it is git.Head while the HEAD is detached)
+	if !stat.Unborn {
+		jobs.Go(func() {
+			errs.check(repo.AbbrevCommitHashVar(ctx, opt.HashLength, &stat.Hash), "get last commit hash")
+		})
+		if opt.needs("Describe") || (stat.Branch == git.Head && opt.needs("Branch")) {
+			jobs.Go(func() {
+				errs.check(repo.DescribeVar(ctx, opt.HashLength, &stat.Describe), "describe HEAD")
+			})
+		}
+		if opt.needs("CommitCount") {
+			jobs.Go(func() {
+				errs.check(repo.CommitCountVar(ctx, &stat.CommitCount), "count commits")
+			})
+		}
+		if opt.needs("Tags", "Tag") {
+			jobs.Go(func() {
+				errs.check(repo.TagsVar(ctx, &stat.Tags), "get tags")
+				if len(stat.Tags) > 0 {
+					stat.Tag = stat.Tags[0]
+				}
+			})
+		}
+		if opt.needs("UpstreamRemote", "UpstreamBranch") {
+			jobs.Go(func() {
+				errs.check(repo.UpstreamRemoteVar(ctx, &stat.UpstreamRemote), "search upstream remote")
+				errs.check(repo.UpstreamBranchVar(ctx, &stat.UpstreamBranch), "search upstream branch")
+			})
+		}
+		if opt.needs("PushUpstream", "PushAhead", "PushBehind") {
+			jobs.Go(func() {
+				errs.check(repo.PushRemoteVar(ctx, &stat.PushUpstream), "search push target")
+				if opt.AheadBehind && stat.PushUpstream != "" {
+					errs.check(repo.AheadCountFromVar(ctx, stat.PushUpstream, &stat.PushAhead), "count ahead from push target")
+					errs.check(repo.BehindCountFromVar(ctx, stat.PushUpstream, &stat.PushBehind), "count behind from push target")
+				}
+			})
+		}
+		if opt.needs("LastEmail", "LastMessage", "LastAuthor", "LastAuthorEmail", "LastCommitRelative", "Wip") {
+			jobs.Go(func() {
+				errs.check(repo.LastCommitterVar(ctx, &stat.LastEmail), "get last committer")
+				errs.check(repo.LastCommitMessageVar(ctx, &stat.LastMessage), "get last commit message")
+				errs.check(repo.LastAuthorVar(ctx, &stat.LastAuthor), "get last author")
+				errs.check(repo.LastAuthorEmailVar(ctx, &stat.LastAuthorEmail), "get last author email")
+				errs.check(repo.LastCommitRelativeVar(ctx, &stat.LastCommitRelative), "get last commit time")
+				if opt.Wip != nil && opt.Wip.MatchString(stat.LastMessage) {
+					stat.Wip = true
+				}
+			})
+		}
+	}
+	if opt.needs("DefaultBranch") {
+		jobs.Go(func() {
+			errs.check(repo.DefaultBranchVar(ctx, &stat.DefaultBranch), "get default branch")
+		})
+	}
+	if opt.needs("RemoteDefault", "Forge", "Name") {
+		jobs.Go(func() {
+			remote, err := repo.Remote(ctx, stat.Branch)
+			errs.check(err, "search remote")
+			if remote != "" {
+				errs.check(repo.RemoteDefaultBranchVar(ctx, remote, &stat.RemoteDefault), "get default branch of the remote")
+			}
+			if opt.NameRemote != "" {
+				remote = opt.NameRemote
+			}
+			remoteURL := stat.Remotes[remote]
+			stat.Forge = forgeOf(remoteURL, opt.Forges)
+			if strings.HasPrefix(remoteURL, "https://github.com/") {
+				stat.Name = strings.TrimSuffix(strings.TrimPrefix(remoteURL, "https://github.com/"), ".git")
+			}
+		})
+	}
+	// detached HEAD shows divergence from the base branch as Ahead/Behind (see below)
+	needsBase := opt.needs("BaseBranch", "BaseBehind", "BaseAhead", "BaseDivergence", "MergeBaseBehind", "MergeBaseAhead") ||
+		(stat.Branch == git.Head && opt.AheadBehind && opt.needs("Ahead", "Behind", "Divergence"))
+	if opt.Base && !stat.Unborn && needsBase {
+		jobs.Go(func() {
+			// --base-branch > branch.<name>.gitprompt-base > gitprompt.baseBranch (local) >
+			// base_branch in the config file > refs/remotes/<remote>/HEAD > guessed from the name >
+			// origin/main or origin/master (see git.BaseBranch)
+			stat.BaseBranch = opt.BaseBranch
+			if stat.BaseBranch == "" {
+				errs.check(repo.ConfiguredBaseBranchVar(ctx, stat.Branch, &stat.BaseBranch), "get configured base branch")
+			}
+			if stat.BaseBranch == "" {
+				stat.BaseBranch = opt.DefaultBaseBranch
+			}
+			if stat.BaseBranch == "" && opt.GuessBaseFirst {
+				errs.check(repo.GuessBaseBranchVar(ctx, stat.Branch, &stat.BaseBranch), "guess base branch")
+			}
+			if stat.BaseBranch == "" {
+				errs.check(repo.BaseBranchVar(ctx, stat.Branch, &stat.BaseBranch), "search base branch")
+			}
+
+			if stat.Upstream != stat.BaseBranch {
+				errs.check(repo.BehindCountFromVar(ctx, stat.BaseBranch, &stat.BaseBehind), "traverse behind objects from base branch")
+				errs.check(repo.AheadCountFromVar(ctx, stat.BaseBranch, &stat.BaseAhead), "traverse ahead objects from base branch")
+			}
+			if opt.MergeBase {
+				var err error
+				stat.MergeBaseAhead, stat.MergeBaseBehind, err = repo.CountFromMergeBase(ctx, stat.BaseBranch)
+				errs.check(err, "count commits from merge-base")
+			}
+		})
+	}
+	if opt.CompareRef != "" && !stat.Unborn && opt.needs("CompareRef", "CompareBehind", "CompareAhead") {
+		jobs.Go(func() {
+			exists, err := repo.RefExists(ctx, opt.CompareRef)
+			errs.check(err, "verify the ref to compare")
+			if exists {
+				stat.CompareRef = opt.CompareRef
+				errs.check(repo.AheadCountFromVar(ctx, stat.CompareRef, &stat.CompareAhead), "count ahead from the ref to compare")
+				errs.check(repo.BehindCountFromVar(ctx, stat.CompareRef, &stat.CompareBehind), "count behind from the ref to compare")
+			} else {
+				ulog.Logger(ctx).WithField("ref", opt.CompareRef).Warn("ref to compare is not found")
+			}
+		})
+	}
+	jobs.Wait()
+
+	if stat.Branch == git.Head {
+		stat.Detached = true
+		stat.Branch = abbrevHash(stat.Hash, opt.HashLength) + "..."
+		// show the name from a tag (e.g. "v1.2.3-4-gabcdef") if there is
+		if stat.Describe != "" && stat.Describe != stat.Hash {
+			stat.Branch = stat.Describe
+		}
+	}
+	if stat.Detached && opt.AheadBehind && stat.BaseBranch != "" {
+		// detached HEAD has no upstream: show divergence from the base branch instead
+		stat.Ahead = stat.BaseAhead
+		stat.Behind = stat.BaseBehind
+	}
+	stat.Divergence = divergence(stat.Ahead, stat.Behind)
+	stat.BaseDivergence = divergence(stat.BaseAhead, stat.BaseBehind)
+
+	stat.ActionDetail = actionDetail(stat.Action, stat.ActionStep, stat.ActionTotal, stat.ConflictCount)
+
+	return stat
+}
+
+// abbrevHash cuts the hash to the length if it is longer.
+// A negative length is taken as zero.
+func abbrevHash(hash string, length int) string {
+	if length < 0 {
+		length = 0
+	}
+	runes := []rune(hash)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return hash
+}
+
+// divergence summarizes ahead and behind counts like "↑2↓1".
+// It is empty if both are zero.
+func divergence(ahead, behind int) string {
+	var summary string
+	if ahead > 0 {
+		summary += "↑" + strconv.Itoa(ahead)
+	}
+	if behind > 0 {
+		summary += "↓" + strconv.Itoa(behind)
+	}
+	return summary
+}
+
+// actionDetail summarizes the action with its step and conflicts like "rebase-i 3/8 ⚠2".
+func actionDetail(action string, step, total, conflicts int) string {
+	if action == "" {
+		return ""
+	}
+	detail := action
+	if total > 0 {
+		detail += " " + strconv.Itoa(step) + "/" + strconv.Itoa(total)
+	}
+	if conflicts > 0 {
+		detail += " ⚠" + strconv.Itoa(conflicts)
+	}
+	return detail
+}
+
+// collectErrors records errors in collecting statuses by what was being done (e.g. "count ahead"),
+// not to fail the prompt for a part of them. It can be used from goroutines.
+type collectErrors struct {
+	ctx    context.Context
+	mutex  sync.Mutex
+	errors map[string]string
+}
+
+func (e *collectErrors) check(err error, doing string) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// the stat is marked as Degraded for the --timeout instead
+		ulog.Logger(e.ctx).WithField("error", err).Debug("gave up to " + doing)
+		return
+	}
+	ulog.Logger(e.ctx).WithField("error", err).Warn("failed to " + doing)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.errors == nil {
+		e.errors = map[string]string{}
+	}
+	e.errors[doing] = err.Error()
+}
@@ -0,0 +1,81 @@
+package prompt_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyoh86/git-prompt/git/testutil"
+	"github.com/kyoh86/git-prompt/prompt"
+)
+
+// TestCollectInWorktree collects statuses in a linked worktree while a merge stops with a conflict.
+func TestCollectInWorktree(t *testing.T) {
+	r := testutil.NewRepo(t)
+	defer r.Remove()
+	r.WriteFile("conflict.txt", "base\n")
+	r.WriteFile("changed.txt", "base\n")
+	r.Commit("base")
+	r.Checkout("other", true)
+	r.WriteFile("conflict.txt", "other\n")
+	r.Commit("other")
+	r.Checkout("main", false)
+
+	parent, err := ioutil.TempDir("", "git-prompt-test")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(parent)
+	wt := filepath.Join(parent, "wt")
+	r.Git("worktree", "add", "--quiet", "-b", "topic", wt, "main")
+	wtGit := func(args ...string) error {
+		cmd := exec.Command("git", append([]string{"-C", wt}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1")
+		return cmd.Run()
+	}
+	if err := ioutil.WriteFile(filepath.Join(wt, "conflict.txt"), []byte("topic\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := wtGit("commit", "--quiet", "--all", "--message", "topic"); err != nil {
+		t.Fatalf("failed to commit in the worktree: %s", err)
+	}
+	if err := wtGit("merge", "--quiet", "other"); err == nil {
+		t.Fatal("expect the merge to stop with a conflict")
+	}
+	if err := ioutil.WriteFile(filepath.Join(wt, "changed.txt"), []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(wt, "untracked.txt"), []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := prompt.Collect(context.Background(), wt, prompt.Options{HashLength: 7, UntrackedMode: "normal"})
+	if err != nil {
+		t.Fatalf("failed to collect: %s", err)
+	}
+	if stat.Errors != nil {
+		t.Errorf("unexpected errors: %v", stat.Errors)
+	}
+	expectRoot, _ := filepath.EvalSymlinks(wt)
+	if actualRoot, _ := filepath.EvalSymlinks(stat.Root); actualRoot != expectRoot {
+		t.Errorf("expect the root %q but got %q", expectRoot, actualRoot)
+	}
+	if stat.Branch != "topic" {
+		t.Errorf("expect the branch topic but got %q", stat.Branch)
+	}
+	if stat.WorktreeName != "wt" || stat.WorktreeCount != 2 {
+		t.Errorf("expect the worktree wt of 2 but got %q of %d", stat.WorktreeName, stat.WorktreeCount)
+	}
+	if stat.Action != "merge" {
+		t.Errorf("expect the action merge but got %q", stat.Action)
+	}
+	if !stat.Conflicted || stat.ConflictCount != 1 {
+		t.Errorf("expect 1 conflict but got %d", stat.ConflictCount)
+	}
+	if !stat.Unstaged || !stat.Untracked {
+		t.Errorf("expect unstaged and untracked files but got %t and %t", stat.Unstaged, stat.Untracked)
+	}
+}
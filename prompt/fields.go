@@ -0,0 +1,17 @@
+package prompt
+
+import "strings"
+
+// FieldKey normalizes a name of the field in the stat to compare (e.g. "last_email" to "lastemail").
+func FieldKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// FieldSet makes a set of keys of the field names for the Fields of the Options.
+func FieldSet(names []string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[FieldKey(name)] = true
+	}
+	return set
+}
@@ -0,0 +1,69 @@
+package prompt
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultForges map host patterns of known forges to short labels.
+// Patterns are matched by path.Match, after forges in the config.
+var defaultForges = []struct {
+	Pattern string
+	Label   string
+}{
+	{"github.com", "gh"},
+	{"gitlab.com", "gl"},
+	{"bitbucket.org", "bb"},
+	{"github.*", "gh"},
+	{"gitlab.*", "gl"},
+	{"bitbucket.*", "bb"},
+}
+
+// forgeOf gets the label of the forge hosting the remote URL.
+// Unknown hosts are returned as they are.
+func forgeOf(remoteURL string, forges map[string]string) string {
+	host := remoteHost(remoteURL)
+	if host == "" {
+		return ""
+	}
+	if label, ok := forges[host]; ok {
+		return label
+	}
+	patterns := make([]string, 0, len(forges))
+	for pattern := range forges {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, host); matched {
+			return forges[pattern]
+		}
+	}
+	for _, forge := range defaultForges {
+		if matched, _ := path.Match(forge.Pattern, host); matched {
+			return forge.Label
+		}
+	}
+	return host
+}
+
+// remoteHost gets the host name from the remote URL
+// like "https://github.com/owner/repo" or "git@github.com:owner/repo".
+// It returns empty for a local path.
+func remoteHost(remoteURL string) string {
+	if u, err := url.Parse(remoteURL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	// scp-like syntax: [user@]host:path (a single letter is a drive on Windows)
+	i := strings.Index(remoteURL, ":")
+	if i <= 1 || strings.Contains(remoteURL[:i], "/") {
+		return ""
+	}
+	host := remoteURL[:i]
+	if j := strings.LastIndex(host, "@"); j >= 0 {
+		host = host[j+1:]
+	}
+	return host
+}
@@ -0,0 +1,32 @@
+package prompt
+
+import "sync"
+
+// parallel runs functions in goroutines, at most the limit of them at once.
+type parallel struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
+
+func newParallel(limit int) *parallel {
+	if limit < 1 {
+		limit = 1
+	}
+	return &parallel{sem: make(chan struct{}, limit)}
+}
+
+// Go runs the function in a goroutine when less than the limit of them are running.
+func (p *parallel) Go(f func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.sem <- struct{}{}
+		defer func() { <-p.sem }()
+		f()
+	}()
+}
+
+// Wait for all of the functions to finish.
+func (p *parallel) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,92 @@
+// Package prompt collects statuses of a git repository to show in prompts.
+package prompt
+
+// Stat holds git statuses.
+//
+// It is output with snake_case names by the "json" style of git-prompt, omitting empty
+// fields except root, name and branch. Renaming or removing a field must bump its schema_version.
+type Stat struct {
+	Root               string   `json:"root"`
+	Name               string   `json:"name"`
+	Subdir             string   `json:"subdir,omitempty"`
+	SubdirShort        string   `json:"subdir_short,omitempty"`
+	SubdirDepth        int      `json:"subdir_depth,omitempty"`
+	InGitDir           bool     `json:"in_git_dir,omitempty"`
+	WorktreeName       string   `json:"worktree_name,omitempty"`
+	WorktreeCount      int      `json:"worktree_count,omitempty"`
+	Degraded           bool     `json:"degraded,omitempty"`
+	Branch             string   `json:"branch"`
+	Detached           bool     `json:"detached,omitempty"`
+	Hash               string   `json:"hash,omitempty"`
+	Describe           string   `json:"describe,omitempty"`
+	HasCommits         bool     `json:"has_commits,omitempty"`
+	Unborn             bool     `json:"unborn,omitempty"`
+	CommitCount        int      `json:"commit_count,omitempty"`
+	Tags               []string `json:"tags,omitempty"`
+	Tag                string   `json:"tag,omitempty"`
+	Staged             bool     `json:"staged,omitempty"`
+	Unstaged           bool     `json:"unstaged,omitempty"`
+	Untracked          bool     `json:"untracked,omitempty"`
+	Conflicted         bool     `json:"conflicted,omitempty"`
+	StagedCount        int      `json:"staged_count,omitempty"`
+	UnstagedCount      int      `json:"unstaged_count,omitempty"`
+	UntrackedCount     int      `json:"untracked_count,omitempty"`
+	UntrackedMode      string   `json:"untracked_mode,omitempty"`
+	StatusExcludes     []string `json:"status_excludes,omitempty"`
+	Insertions         int      `json:"insertions,omitempty"`
+	Deletions          int      `json:"deletions,omitempty"`
+	StagedInsertions   int      `json:"staged_insertions,omitempty"`
+	StagedDeletions    int      `json:"staged_deletions,omitempty"`
+	DirtySubmodules    int      `json:"dirty_submodules,omitempty"`
+	SubmoduleCount     int      `json:"submodule_count,omitempty"`
+	SubmoduleDirty     bool     `json:"submodule_dirty,omitempty"`
+	SubmoduleOutOfSync bool     `json:"submodule_out_of_sync,omitempty"`
+	// LFSPending counts LFS files changed but not committed (so not pushed) yet.
+	LFSPending         int               `json:"lfs_pending,omitempty"`
+	Shallow            bool              `json:"shallow,omitempty"`
+	Partial            bool              `json:"partial,omitempty"`
+	Email              string            `json:"email,omitempty"`
+	LocalEmailSet      bool              `json:"local_email_set,omitempty"`
+	StashCount         int               `json:"stash_count,omitempty"`
+	StashLatestMessage string            `json:"stash_latest_message,omitempty"`
+	StashLatestAge     string            `json:"stash_latest_age,omitempty"`
+	LastEmail          string            `json:"last_email,omitempty"`
+	LastMessage        string            `json:"last_message,omitempty"`
+	LastAuthor         string            `json:"last_author,omitempty"`
+	LastAuthorEmail    string            `json:"last_author_email,omitempty"`
+	LastCommitRelative string            `json:"last_commit_relative,omitempty"`
+	Wip                bool              `json:"wip,omitempty"`
+	Upstream           string            `json:"upstream,omitempty"`
+	UpstreamRemote     string            `json:"upstream_remote,omitempty"`
+	UpstreamBranch     string            `json:"upstream_branch,omitempty"`
+	UpstreamGone       bool              `json:"upstream_gone,omitempty"`
+	Remotes            map[string]string `json:"remotes,omitempty"`
+	Forge              string            `json:"forge,omitempty"`
+	RemoteDefault      string            `json:"remote_default,omitempty"`
+	DefaultBranch      string            `json:"default_branch,omitempty"`
+	PushUpstream       string            `json:"push_upstream,omitempty"`
+	PushAhead          int               `json:"push_ahead,omitempty"`
+	PushBehind         int               `json:"push_behind,omitempty"`
+	Behind             int               `json:"behind,omitempty"`
+	Ahead              int               `json:"ahead,omitempty"`
+	Divergence         string            `json:"divergence,omitempty"`
+	BaseBranch         string            `json:"base_branch,omitempty"`
+	BaseBehind         int               `json:"base_behind,omitempty"`
+	BaseAhead          int               `json:"base_ahead,omitempty"`
+	BaseDivergence     string            `json:"base_divergence,omitempty"`
+	// BaseAhead/BaseBehind compare the tips, and MergeBaseAhead/MergeBaseBehind count
+	// from the merge-base (see git.CountFromMergeBase): they differ after criss-cross merges.
+	MergeBaseBehind int               `json:"merge_base_behind,omitempty"`
+	MergeBaseAhead  int               `json:"merge_base_ahead,omitempty"`
+	CompareRef      string            `json:"compare_ref,omitempty"`
+	CompareBehind   int               `json:"compare_behind,omitempty"`
+	CompareAhead    int               `json:"compare_ahead,omitempty"`
+	Action          string            `json:"action,omitempty"`
+	ActionStep      int               `json:"action_step,omitempty"`
+	ActionTotal     int               `json:"action_total,omitempty"`
+	ActionDetail    string            `json:"action_detail,omitempty"`
+	Operation       string            `json:"operation,omitempty"`
+	ConflictCount   int               `json:"conflict_count,omitempty"`
+	Raw             string            `json:"raw,omitempty"`
+	Errors          map[string]string `json:"errors,omitempty"`
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sort"
+)
+
+// defaultStyle is a template shared by the styles.
+// Colors are given by roles with the "color" function, so they follow the --theme.
+const defaultStyle = `
+	{{- if .Conflicted}}{{color "conflicted" (symbol "conflicted")}}{{end -}}
+	{{- if .Staged}}{{color "dirty" (symbol "staged")}}{{end -}}
+	{{- if .Unstaged}}{{color "dirty" (symbol "unstaged")}}{{end -}}
+	{{- if .Untracked}}{{color "dirty" (symbol "untracked")}}{{end -}}
+	{{- if and .Wip (eq .Email .LastEmail)}}{{color "wip" (symbol "wip")}}{{end -}}
+	{{- if gt .Ahead 0}}{{color "ahead" (print (symbol "ahead") " " .Ahead)}}{{end -}}
+	{{- if gt .Behind 0}}{{color "behind" (print (symbol "behind") " " .Behind)}}{{end -}}
+	{{- if or (gt .BaseAhead 0) (gt .BaseBehind 0) -}}
+		{{color "base" (print "(" .BaseBranch)}}
+		{{- if gt .BaseAhead 0}}{{color "base_ahead" (print "+" .BaseAhead)}}{{end -}}
+		{{- if gt .BaseBehind 0}}{{color "base_behind" (print "-" .BaseBehind)}}{{end -}}
+		{{color "base" ")"}}
+	{{- end -}}
+	{{- if gt .StashCount 0}}{{color "stash" (print (symbol "stash") " " .StashCount)}}{{end}} {{color "name" (print "[" .Name)}}
+	{{- if ne .Subdir "."}}{{color "subdir" (print "/" .Subdir)}}{{end -}}
+	{{- if and (ne .Branch "main") (ne .Branch "")}}{{color "branch" (print ":" .Branch)}}{{end -}}
+	{{- if .Errors}}{{color "error" (symbol "error")}}{{end -}}
+	{{- if .ActionDetail}}{{color "action" (print "|" .ActionDetail)}}{{end -}}
+	{{- if .Degraded}}{{color "no_upstream" (symbol "degraded")}}{{else if eq .Upstream ""}}{{color "no_upstream" (symbol "no_upstream")}}{{end -}}
+	{{color "name" "]"}}`
+
+// shortStyle is a terse template for zsh (e.g. RPROMPT): the branch, "*" if dirty and ahead/behind.
+const shortStyle = `{{color "branch" .Branch}}
+	{{- if .Conflicted}}{{color "conflicted" "!"}}{{else if or .Staged .Unstaged .Untracked}}{{color "dirty" "*"}}{{end -}}
+	{{- if gt .Ahead 0}}{{color "ahead" (print "↑" .Ahead)}}{{end -}}
+	{{- if gt .Behind 0}}{{color "behind" (print "↓" .Behind)}}{{end -}}`
+
+// styles are named templates for the --style.
+var styles = map[string]string{
+	"zsh":            defaultStyle,
+	"zsh-zero-width": defaultStyle,
+	"short":          shortStyle,
+	"bash":           defaultStyle,
+	"tmux":           "#[bg=black]" + defaultStyle + "#[fg=black,bg=colour8]\ue0b0",
+	"ansi":           defaultStyle + "\x1b[0m",
+	// PowerShell (on Windows Terminal or conhost with VT enabled) understands raw SGR sequences.
+	"pwsh":       defaultStyle + "\x1b[0m",
+	"powershell": defaultStyle + "\x1b[0m",
+	// oh-my-posh colors the output of a "command" segment by itself: it has no colorizer.
+	"oh-my-posh": defaultStyle,
+}
+
+// styleEscapes are the escapes of values for the styles with the --escape=auto.
+// Styles in the config file follow their colorizer.
+var styleEscapes = map[string]string{
+	"bash": "bash",
+}
+
+// styleNames lists the names which can be given to the --style.
+func styleNames() []string {
+	names := make([]string, 0, len(styles)+5)
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, "pretty", "json", "format:<template>", "f:<template>", "file:<path>")
+}
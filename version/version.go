@@ -0,0 +1,14 @@
+// Package version holds build metadata set by -ldflags "-X".
+package version
+
+// nolint
+var (
+	Version = "snapshot"
+	Commit  = "snapshot"
+	Date    = "snapshot"
+)
+
+// String formats the build metadata.
+func String() string {
+	return Version + " (commit: " + Commit + ", date: " + Date + ")"
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kyoh86/git-prompt/git"
+	"github.com/wacul/ulog"
+)
+
+// watch calls the output at first and whenever the git directory of the repository changes,
+// until SIGINT or SIGTERM. Changes in a series are merged into one call after the delay.
+func watch(ctx context.Context, repo *git.Git, delay time.Duration, output func()) error {
+	logger := ulog.Logger(ctx)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// HEAD, index, MERGE_HEAD and so on are in the gitDir of the worktree,
+	// and branches are under the refs in the commonDir shared by worktrees.
+	gitDir := repo.GitDir()
+	commonDir, err := repo.CommonDir()
+	if err != nil {
+		return err
+	}
+	refsDir := filepath.Join(commonDir, "refs")
+	for _, dir := range []string{gitDir, commonDir} {
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+	if err := filepath.Walk(refsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		return watcher.Add(path)
+	}); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	output()
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-signals:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if strings.HasSuffix(event.Name, ".lock") {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 && strings.HasPrefix(event.Name, refsDir) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watcher.Add(event.Name); err != nil {
+						logger.WithField("error", err).Warn("failed to watch a directory")
+					}
+				}
+			}
+			timer = time.After(delay)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.WithField("error", err).Warn("failed to watch the repository")
+		case <-timer:
+			timer = nil
+			output()
+		}
+	}
+}